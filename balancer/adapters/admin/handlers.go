@@ -0,0 +1,151 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"testtask/balancer/adapters/server"
+	"testtask/balancer/config"
+	"testtask/balancer/core"
+)
+
+// Admin API для управления пулом серверов без перезапуска балансировщика
+
+// GetServersHandler - GET /servers
+// Выводит список серверов пула с их состоянием и статистикой в формате JSON
+func GetServersHandler(lb *core.LoadBalancer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		servers := lb.Servers()
+		infos := make([]core.ServerInfo, 0, len(servers))
+		for _, s := range servers {
+			infos = append(infos, core.ServerInfo{
+				URL:               s.GetUrl().String(),
+				Weight:            s.GetWeight(),
+				Healthy:           s.IsHealthy(),
+				Draining:          s.IsDraining(),
+				ActiveConnections: s.GetConnections(),
+				TotalRequests:     s.GetTotalRequests(),
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(infos)
+	}
+}
+
+// AddServerHandler - POST /servers
+// Добавляет сервер в пул
+// Принимает JSON вида:
+// {"url": "string", "weight": int}
+func AddServerHandler(log *slog.Logger, lb *core.LoadBalancer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req core.ServerRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Error("failed to decode request", "error", err)
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if req.URL == "" {
+			http.Error(w, "url is required", http.StatusBadRequest)
+			return
+		}
+		if err := config.ValidateServerURL(req.URL); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		srv, err := server.NewServerFromURL(req.URL, req.Weight)
+		if err != nil {
+			http.Error(w, "invalid url", http.StatusBadRequest)
+			return
+		}
+
+		if err := lb.AddServer(srv); err != nil {
+			log.Error("failed to add server", "url", req.URL, "error", err)
+			if errors.Is(err, core.ErrServerExists) {
+				http.Error(w, "server already exists", http.StatusConflict)
+				return
+			}
+			http.Error(w, "failed to add server", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"status": "server added"})
+	}
+}
+
+// RemoveServerHandler - DELETE /server?url={url}
+// Удаляет сервер из пула, запросы, которые уже ушли на сервер, дорабатывают
+func RemoveServerHandler(log *slog.Logger, lb *core.LoadBalancer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		serverURL, ok := parseServerURL(w, r.URL.Query().Get("url"))
+		if !ok {
+			return
+		}
+
+		if err := lb.RemoveServer(serverURL); err != nil {
+			log.Error("failed to remove server", "url", serverURL.String(), "error", err)
+			writeServerError(w, err, "failed to remove server")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "server removed"})
+	}
+}
+
+// UpdateServerHandler - PUT /server
+// Включает или выключает вывод сервера из работы (drain): новые запросы на него не идут, текущие дорабатывают
+// Принимает JSON вида:
+// {"url": "string", "draining": bool}
+func UpdateServerHandler(log *slog.Logger, lb *core.LoadBalancer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req core.ServerRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Error("failed to decode request", "error", err)
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		serverURL, ok := parseServerURL(w, req.URL)
+		if !ok {
+			return
+		}
+
+		if err := lb.DrainServer(serverURL, req.Draining); err != nil {
+			log.Error("failed to update server", "url", serverURL.String(), "error", err)
+			writeServerError(w, err, "failed to update server")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "server updated"})
+	}
+}
+
+func parseServerURL(w http.ResponseWriter, rawURL string) (*url.URL, bool) {
+	if rawURL == "" {
+		http.Error(w, "url is required", http.StatusBadRequest)
+		return nil, false
+	}
+
+	serverURL, err := url.Parse(rawURL)
+	if err != nil {
+		http.Error(w, "invalid url", http.StatusBadRequest)
+		return nil, false
+	}
+	return serverURL, true
+}
+
+func writeServerError(w http.ResponseWriter, err error, message string) {
+	if errors.Is(err, core.ErrServerNotFound) {
+		http.Error(w, "server not found", http.StatusNotFound)
+		return
+	}
+	http.Error(w, message, http.StatusInternalServerError)
+}
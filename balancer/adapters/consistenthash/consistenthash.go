@@ -0,0 +1,211 @@
+package consistenthash
+
+import (
+	"hash/fnv"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testtask/balancer/adapters/pool"
+	"testtask/balancer/config"
+	"testtask/balancer/core"
+)
+
+// Точка на кольце: хеш виртуального узла и индекс сервера, которому он принадлежит
+type point struct {
+	hash  uint64
+	index int
+}
+
+// Пул на основе кольца consistent hashing с ограничением нагрузки (bounded loads).
+// Каждый сервер занимает replicas * weight точек на кольце, запрос уходит на первый по часовой стрелке рабочий сервер.
+// При добавлении или удалении сервера меняется только часть ключей, которая приходилась на этот сервер.
+// Если задан load_factor, сервер пропускается, когда его активных запросов больше чем load_factor * средняя нагрузка
+type ConsistentHash struct {
+	*pool.Pool
+	log *slog.Logger
+	cfg config.ConsistentHashConfig
+	// Кольцо перестраивается при изменении пула под его блокировкой на запись и читается под блокировкой на чтение
+	ring    []point
+	current uint64
+}
+
+func NewConsistentHash(log *slog.Logger, servers []core.Server, checker core.HealthChecker, cfg config.ConsistentHashConfig) *ConsistentHash {
+	if cfg.Replicas <= 0 {
+		cfg.Replicas = 100
+	}
+
+	c := &ConsistentHash{
+		Pool: pool.New(servers, checker),
+		log:  log,
+		cfg:  cfg,
+	}
+	c.OnChange(c.rebuild)
+	return c
+}
+
+// Возвращаем индекс сервера для запроса без ключа, -1 если рабочих серверов нет
+func (c *ConsistentHash) GetNextIndex() int {
+	idx := -1
+	c.Read(func(servers []core.Server) {
+		idx = c.lookup(servers, c.anonymousKey(), nil)
+	})
+	return idx
+}
+
+// Без запроса ключа нет, поэтому ключи берем из счетчика и запросы расходятся по кольцу равномерно
+func (c *ConsistentHash) GetNextServer(exclude ...core.Server) core.Server {
+	return c.server(c.anonymousKey(), exclude)
+}
+
+// Выбирает сервер по ключу, извлеченному из запроса. Серверы из exclude пропускаются
+func (c *ConsistentHash) GetServerForRequest(r *http.Request, exclude ...core.Server) core.Server {
+	key, ok := c.requestKey(r)
+	if !ok {
+		return c.GetNextServer(exclude...)
+	}
+	return c.server(key, exclude)
+}
+
+func (c *ConsistentHash) server(key string, exclude []core.Server) core.Server {
+	var next core.Server
+	c.Read(func(servers []core.Server) {
+		if idx := c.lookup(servers, key, exclude); idx != -1 {
+			next = servers[idx]
+		}
+	})
+	return next
+}
+
+// Перестраивает кольцо, вызывается пулом под блокировкой на запись
+func (c *ConsistentHash) rebuild(servers []core.Server) {
+	ring := make([]point, 0, len(servers)*c.cfg.Replicas)
+	for i, server := range servers {
+		replicas := c.cfg.Replicas * server.GetWeight()
+		for r := 0; r < replicas; r++ {
+			ring = append(ring, point{
+				hash:  hashKey(server.GetUrl().String() + "#" + strconv.Itoa(r)),
+				index: i,
+			})
+		}
+	}
+
+	sort.Slice(ring, func(i, j int) bool {
+		return ring[i].hash < ring[j].hash
+	})
+	c.ring = ring
+}
+
+// Ищет сервер для ключа, вызывается под блокировкой на чтение
+func (c *ConsistentHash) lookup(servers []core.Server, key string, exclude []core.Server) int {
+	if len(c.ring) == 0 {
+		return -1
+	}
+
+	limit := loadLimit(servers, exclude, c.cfg.LoadFactor)
+	h := hashKey(key)
+	start := sort.Search(len(c.ring), func(i int) bool {
+		return c.ring[i].hash >= h
+	})
+
+	// Запоминаем первый подходящий сервер без учета нагрузки на случай, если все серверы перегружены
+	fallback := -1
+	checked := make(map[int]bool, len(servers))
+	for i := 0; i < len(c.ring) && len(checked) < len(servers); i++ {
+		idx := c.ring[(start+i)%len(c.ring)].index
+		if checked[idx] {
+			continue
+		}
+		checked[idx] = true
+
+		server := servers[idx]
+		if !server.IsWorking() || core.ContainsServer(exclude, server) {
+			continue
+		}
+		if fallback == -1 {
+			fallback = idx
+		}
+		if limit == 0 || server.GetConnections() < limit {
+			return idx
+		}
+	}
+	return fallback
+}
+
+// Максимальное число активных запросов на сервер: load_factor от средней нагрузки с учетом нового запроса.
+// 0 означает, что ограничение нагрузки выключено
+func loadLimit(servers []core.Server, exclude []core.Server, loadFactor float64) int64 {
+	if loadFactor <= 0 {
+		return 0
+	}
+
+	var total int64
+	working := 0
+	for _, server := range servers {
+		if !server.IsWorking() || core.ContainsServer(exclude, server) {
+			continue
+		}
+		total += server.GetConnections()
+		working++
+	}
+	if working == 0 {
+		return 0
+	}
+
+	return int64(math.Ceil(float64(total+1) / float64(working) * loadFactor))
+}
+
+func (c *ConsistentHash) anonymousKey() string {
+	return strconv.FormatUint(atomic.AddUint64(&c.current, 1), 10)
+}
+
+// Достает ключ из запроса согласно настройке key: ip, header, path или query
+func (c *ConsistentHash) requestKey(r *http.Request) (string, bool) {
+	var key string
+	switch c.cfg.Key {
+	case "header":
+		key = r.Header.Get(c.cfg.Name)
+	case "query":
+		key = r.URL.Query().Get(c.cfg.Name)
+	case "path":
+		key = pathPrefix(r.URL.Path, c.cfg.PathSegments)
+	default:
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		key = host
+	}
+	return key, key != ""
+}
+
+// Возвращает первые n сегментов пути, например /users/42/orders при n = 2 дает /users/42
+func pathPrefix(path string, n int) string {
+	if n <= 0 {
+		return path
+	}
+
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) > n {
+		segments = segments[:n]
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// FNV-1a с финальным перемешиванием из splitmix64, чтобы похожие строки равномерно ложились на кольцо.
+// Хеш детерминирован, поэтому несколько балансировщиков с одним конфигом раскладывают ключи одинаково
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
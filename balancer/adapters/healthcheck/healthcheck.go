@@ -0,0 +1,189 @@
+package healthcheck
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"testtask/balancer/config"
+	"testtask/balancer/core"
+)
+
+// Ограничиваем объем тела ответа, который читаем для проверки body_match
+const maxBodySize = 64 * 1024
+
+// Счетчики подряд идущих успешных и неуспешных проверок сервера
+type counters struct {
+	successes int
+	failures  int
+	healthy   bool
+}
+
+type HealthChecker struct {
+	log     *slog.Logger
+	metrics core.Metrics
+	cfg     config.HealthCheckConfig
+	client  *http.Client
+	mu      sync.Mutex
+	state   map[string]*counters
+}
+
+func New(log *slog.Logger, cfg config.HealthCheckConfig, metrics core.Metrics) *HealthChecker {
+	h := &HealthChecker{
+		log:     log,
+		metrics: metrics,
+		state:   make(map[string]*counters),
+	}
+	h.Update(cfg)
+	return h
+}
+
+// Применяет новые настройки проверки, например после перезагрузки конфига.
+// Накопленные счетчики сохраняются, новые пороги применяются со следующей проверки
+func (h *HealthChecker) Update(cfg config.HealthCheckConfig) {
+	if cfg.Rise <= 0 {
+		cfg.Rise = 1
+	}
+	if cfg.Fall <= 0 {
+		cfg.Fall = 1
+	}
+
+	client := &http.Client{
+		Timeout: cfg.Timeout,
+		// Редиректы не проходим, код 3xx сравнивается с ожидаемыми как есть
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.cfg = cfg
+	h.client = client
+}
+
+func (h *HealthChecker) settings() (config.HealthCheckConfig, *http.Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.cfg, h.client
+}
+
+// Проверяет сервер и меняет его статус, только если набралось rise успешных или fall неуспешных проверок подряд
+func (h *HealthChecker) Check(server core.Server) {
+	serverURL := server.GetUrl()
+	ok := h.IsServerWorking(serverURL)
+	h.metrics.ObserveHealthCheck(server, ok)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	c, exists := h.state[serverURL.String()]
+	if !exists {
+		c = &counters{healthy: server.IsHealthy()}
+		h.state[serverURL.String()] = c
+	}
+
+	// Статус мог поменяться в обход healthcheck (например, пассивной проверкой), тогда считаем пороги заново
+	if c.healthy != server.IsHealthy() {
+		c.successes = 0
+		c.failures = 0
+	}
+
+	if ok {
+		c.successes++
+		c.failures = 0
+		if !server.IsHealthy() && c.successes >= h.cfg.Rise {
+			server.SetStatus(true)
+			h.log.Info("Server is back", "url", serverURL.String(), "successes", c.successes)
+		}
+	} else {
+		c.failures++
+		c.successes = 0
+		if server.IsHealthy() && c.failures >= h.cfg.Fall {
+			server.SetStatus(false)
+			h.log.Warn("Server is down", "url", serverURL.String(), "failures", c.failures)
+		}
+	}
+
+	c.healthy = server.IsHealthy()
+
+	stat := "working"
+	if !c.healthy {
+		stat = "failed"
+	}
+	h.log.Info("Server status", "url", serverURL.String(), "status", stat)
+}
+
+// Выполняет одну проверку сервера без учета порогов
+func (h *HealthChecker) IsServerWorking(serverURL *url.URL) bool {
+	cfg, client := h.settings()
+
+	var err error
+	switch cfg.Type {
+	case "http":
+		err = probeHTTP(serverURL, cfg, client)
+	default:
+		err = probeTCP(serverURL, cfg)
+	}
+
+	if err != nil {
+		h.log.Error("Server failed", "url", serverURL, "error", err)
+		return false
+	}
+	return true
+}
+
+// Метод для установления соединения с конкретным сервером, чтобы проверить его состояние
+func probeTCP(serverURL *url.URL, cfg config.HealthCheckConfig) error {
+	conn, err := net.DialTimeout("tcp", serverURL.Host, cfg.Timeout)
+	if err != nil {
+		return err
+	}
+	_ = conn.Close()
+	return nil
+}
+
+// Отправляет HTTP запрос на path и проверяет код ответа и, если задано, наличие подстроки в теле
+func probeHTTP(serverURL *url.URL, cfg config.HealthCheckConfig, client *http.Client) error {
+	probeURL := serverURL.JoinPath(cfg.Path)
+
+	req, err := http.NewRequest(cfg.Method, probeURL.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if !isExpectedStatus(cfg.ExpectedStatuses, resp.StatusCode) {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	if cfg.BodyMatch != "" {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+		if err != nil {
+			return err
+		}
+		if !bytes.Contains(body, []byte(cfg.BodyMatch)) {
+			return fmt.Errorf("response body does not contain %q", cfg.BodyMatch)
+		}
+	}
+
+	return nil
+}
+
+// Если ожидаемые коды не заданы, рабочим считается любой ответ 2xx
+func isExpectedStatus(expected []int, code int) bool {
+	if len(expected) == 0 {
+		return code >= 200 && code < 300
+	}
+	return slices.Contains(expected, code)
+}
@@ -0,0 +1,66 @@
+package leastconn
+
+import (
+	"log/slog"
+	"sync/atomic"
+	"testtask/balancer/adapters/pool"
+	"testtask/balancer/core"
+)
+
+type LeastConn struct {
+	*pool.Pool
+	log     *slog.Logger
+	current uint64
+}
+
+func NewLeastConn(log *slog.Logger, servers []core.Server, checker core.HealthChecker) *LeastConn {
+	return &LeastConn{
+		Pool: pool.New(servers, checker),
+		log:  log,
+	}
+}
+
+// Возвращаем индекс рабочего сервера с наименьшим количеством активных запросов, -1 если таких нет
+// Обход начинаем со смещения, чтобы при равной нагрузке запросы распределялись по кругу, а не уходили на первый сервер
+func (l *LeastConn) GetNextIndex() int {
+	idx := -1
+	l.Read(func(servers []core.Server) {
+		idx = l.nextIndex(servers, nil)
+	})
+	return idx
+}
+
+func (l *LeastConn) nextIndex(servers []core.Server, exclude []core.Server) int {
+	if len(servers) == 0 {
+		return -1
+	}
+
+	start := int(atomic.AddUint64(&l.current, 1) % uint64(len(servers)))
+	best := -1
+	var bestConns int64
+
+	for i := 0; i < len(servers); i++ {
+		idx := (start + i) % len(servers)
+		server := servers[idx]
+		if !server.IsWorking() || core.ContainsServer(exclude, server) {
+			continue
+		}
+		conns := server.GetConnections()
+		if best == -1 || conns < bestConns {
+			best = idx
+			bestConns = conns
+		}
+	}
+	return best
+}
+
+// Серверы из exclude пропускаются, например, при повторе запроса после ошибки
+func (l *LeastConn) GetNextServer(exclude ...core.Server) core.Server {
+	var next core.Server
+	l.Read(func(servers []core.Server) {
+		if idx := l.nextIndex(servers, exclude); idx != -1 {
+			next = servers[idx]
+		}
+	})
+	return next
+}
@@ -0,0 +1,132 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"testtask/balancer/core"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Метрики балансировщика в формате Prometheus. Счетчики обновляются балансировщиком и healthcheck,
+// а состояние серверов и активные запросы снимаются с пула в момент сбора метрик
+type Metrics struct {
+	registry     *prometheus.Registry
+	requests     *prometheus.CounterVec
+	latency      *prometheus.HistogramVec
+	healthChecks *prometheus.CounterVec
+	noBackend    prometheus.Counter
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "balancer_requests_total",
+			Help: "Requests proxied to backends by status class.",
+		}, []string{"backend", "code"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "balancer_upstream_request_duration_seconds",
+			Help:    "Time spent proxying a request to a backend.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"backend"}),
+		healthChecks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "balancer_healthchecks_total",
+			Help: "Active health check results by backend.",
+		}, []string{"backend", "result"}),
+		noBackend: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "balancer_no_backend_available_total",
+			Help: "Requests rejected with 503 because no backend was available.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		m.requests,
+		m.latency,
+		m.healthChecks,
+		m.noBackend,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// Подключает сбор состояния серверов пула: здоровье, drain и активные запросы
+func (m *Metrics) RegisterServers(servers func() []core.Server) {
+	m.registry.MustRegister(&serversCollector{servers: servers})
+}
+
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+func (m *Metrics) ObserveRequest(server core.Server, code int, duration time.Duration) {
+	backend := server.GetUrl().String()
+	m.requests.WithLabelValues(backend, codeClass(code)).Inc()
+	m.latency.WithLabelValues(backend).Observe(duration.Seconds())
+}
+
+func (m *Metrics) ObserveHealthCheck(server core.Server, ok bool) {
+	result := "success"
+	if !ok {
+		result = "failure"
+	}
+	m.healthChecks.WithLabelValues(server.GetUrl().String(), result).Inc()
+}
+
+func (m *Metrics) NoBackendAvailable() {
+	m.noBackend.Inc()
+}
+
+// Класс кода ответа: 2xx, 3xx, 4xx, 5xx
+func codeClass(code int) string {
+	return strconv.Itoa(code/100) + "xx"
+}
+
+var (
+	upDesc = prometheus.NewDesc(
+		"balancer_backend_up",
+		"Whether the backend passed its health checks (1) or not (0).",
+		[]string{"backend"}, nil,
+	)
+	drainingDesc = prometheus.NewDesc(
+		"balancer_backend_draining",
+		"Whether the backend is draining (1) or not (0).",
+		[]string{"backend"}, nil,
+	)
+	inFlightDesc = prometheus.NewDesc(
+		"balancer_in_flight_requests",
+		"Requests currently being proxied to the backend.",
+		[]string{"backend"}, nil,
+	)
+)
+
+// Снимает состояние с текущего списка серверов, поэтому удаленные серверы сразу пропадают из метрик
+type serversCollector struct {
+	servers func() []core.Server
+}
+
+func (c *serversCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- upDesc
+	ch <- drainingDesc
+	ch <- inFlightDesc
+}
+
+func (c *serversCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, server := range c.servers() {
+		backend := server.GetUrl().String()
+		ch <- prometheus.MustNewConstMetric(upDesc, prometheus.GaugeValue, boolValue(server.IsHealthy()), backend)
+		ch <- prometheus.MustNewConstMetric(drainingDesc, prometheus.GaugeValue, boolValue(server.IsDraining()), backend)
+		ch <- prometheus.MustNewConstMetric(inFlightDesc, prometheus.GaugeValue, float64(server.GetConnections()), backend)
+	}
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
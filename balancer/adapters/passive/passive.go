@@ -0,0 +1,62 @@
+package passive
+
+import (
+	"log/slog"
+	"sync"
+	"testtask/balancer/core"
+	"time"
+)
+
+// Пассивная проверка серверов по живому трафику: если за окно fail_window набирается max_fails ошибок,
+// сервер выводится из пула через Pooler. Вернуть его обратно может только активный healthcheck
+type PassiveChecker struct {
+	log      *slog.Logger
+	pool     core.Pooler
+	maxFails int
+	window   time.Duration
+	mu       sync.Mutex
+	failures map[string][]time.Time
+}
+
+func New(log *slog.Logger, pool core.Pooler, maxFails int, window time.Duration) *PassiveChecker {
+	if maxFails <= 0 {
+		maxFails = 1
+	}
+
+	return &PassiveChecker{
+		log:      log,
+		pool:     pool,
+		maxFails: maxFails,
+		window:   window,
+		failures: make(map[string][]time.Time),
+	}
+}
+
+func (p *PassiveChecker) ReportFailure(server core.Server) {
+	if !server.IsHealthy() {
+		return
+	}
+
+	key := server.GetUrl().String()
+	now := time.Now()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Оставляем только ошибки, попавшие в текущее окно
+	failures := p.failures[key]
+	i := 0
+	for i < len(failures) && now.Sub(failures[i]) > p.window {
+		i++
+	}
+	failures = append(failures[i:], now)
+
+	if len(failures) < p.maxFails {
+		p.failures[key] = failures
+		return
+	}
+
+	delete(p.failures, key)
+	p.pool.ChangeServerStatus(server.GetUrl(), false)
+	p.log.Warn("Server marked down by passive health check", "url", key, "failures", len(failures), "window", p.window)
+}
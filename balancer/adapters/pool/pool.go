@@ -0,0 +1,123 @@
+package pool
+
+import (
+	"net/url"
+	"slices"
+	"sync"
+	"testtask/balancer/core"
+)
+
+// Общая часть всех алгоритмов балансировки: список серверов, его блокировка, веса, статусы и healthcheck.
+// Алгоритм встраивает Pool и реализует только выбор сервера, читая список через Read
+type Pool struct {
+	checker core.HealthChecker
+	mu      sync.RWMutex
+	servers []core.Server
+	changed func([]core.Server)
+}
+
+func New(servers []core.Server, checker core.HealthChecker) *Pool {
+	return &Pool{
+		checker: checker,
+		servers: servers,
+	}
+}
+
+// Задает функцию, которая вызывается под блокировкой на запись после изменения списка серверов или их весов,
+// например для перестроения кольца consistent hashing. Сразу вызывает ее для текущего списка
+func (p *Pool) OnChange(fn func(servers []core.Server)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.changed = fn
+	fn(p.servers)
+}
+
+// Выполняет fn над списком серверов под блокировкой на чтение, fn не должна менять список
+func (p *Pool) Read(fn func(servers []core.Server)) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	fn(p.servers)
+}
+
+func (p *Pool) change() {
+	if p.changed != nil {
+		p.changed(p.servers)
+	}
+}
+
+// Добавляем сервер в пул серверов, возвращаем false если сервер с таким адресом уже есть
+func (p *Pool) AddServer(server core.Server) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if core.ContainsServer(p.servers, server) {
+		return false
+	}
+	p.servers = append(p.servers, server)
+	p.change()
+	return true
+}
+
+// Удаляем сервер из пула, возвращаем false если такого сервера нет
+func (p *Pool) RemoveServer(serverUrl *url.URL) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, server := range p.servers {
+		if server.GetUrl().String() == serverUrl.String() {
+			p.servers = slices.Delete(p.servers, i, i+1)
+			p.change()
+			return true
+		}
+	}
+	return false
+}
+
+// Меняем вес сервера, возвращаем false если такого сервера нет
+func (p *Pool) UpdateServerWeight(serverUrl *url.URL, weight int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, server := range p.servers {
+		if server.GetUrl().String() == serverUrl.String() {
+			server.SetWeight(weight)
+			p.change()
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Pool) ChangeServerStatus(serverUrl *url.URL, status bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for _, server := range p.servers {
+		if server.GetUrl().String() == serverUrl.String() {
+			server.SetStatus(status)
+			break
+		}
+	}
+}
+
+// Возвращает копию списка серверов пула
+func (p *Pool) GetServers() []core.Server {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	servers := make([]core.Server, len(p.servers))
+	copy(servers, p.servers)
+	return servers
+}
+
+// Метод для проверки состояниий серверов в пуле
+func (p *Pool) HealthCheck() {
+	// Проверки идут по копии списка без блокировки, чтобы не останавливать выбор серверов на время сетевых запросов
+	for _, server := range p.GetServers() {
+		p.checker.Check(server)
+	}
+}
+
+// Метод для однократной проверки конкретного сервера
+func (p *Pool) IsServerWorking(url *url.URL) bool {
+	return p.checker.IsServerWorking(url)
+}
@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"testtask/balancer/config"
+	"testtask/limiter/adapters/cache"
+	"testtask/limiter/adapters/cost"
+	"testtask/limiter/adapters/identity"
+	"testtask/limiter/adapters/ratelimiter"
+	"testtask/limiter/adapters/rest/middleware"
+	"testtask/limiter/adapters/storage"
+	limiterconfig "testtask/limiter/config"
+	"testtask/limiter/core"
+)
+
+// Лимитер из пакета limiter, встроенный в балансировщик. Решение принимается в процессе балансировщика,
+// отклоненные запросы получают 429 с заголовками RateLimit-* и не доходят до бэкендов
+type RateLimit struct {
+	limiter    core.RateLimiter
+	storage    storage.Storage
+	db         core.RateLimiterDB
+	cache      *cache.Cache
+	identifier core.ClientIdentifier
+	cost       core.RequestCost
+}
+
+func New(ctx context.Context, log *slog.Logger, cfg config.RateLimitMiddlewareConfig) (*RateLimit, error) {
+	identifier, err := identity.New(cfg.Identity)
+	if err != nil {
+		return nil, err
+	}
+
+	requestCost, err := cost.New(cfg.Cost)
+	if err != nil {
+		return nil, err
+	}
+
+	limiter, err := ratelimiter.NewSelector(log, limiterconfig.Config{RateLimit: cfg.RateLimit})
+	if err != nil {
+		return nil, err
+	}
+
+	storage, err := storage.New(ctx, log, cfg.DBAddress, cfg.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	rl := &RateLimit{
+		limiter:    limiter,
+		storage:    storage,
+		db:         storage,
+		identifier: identifier,
+		cost:       requestCost,
+	}
+
+	// Локальный кэш токенов, как в лимитере
+	if c := cfg.Storage.Cache; c.Mode != "off" {
+		rl.cache, err = cache.New(log, storage, c.Mode, c.SyncInterval, c.LeaseSize)
+		if err != nil {
+			storage.Close()
+			return nil, err
+		}
+		rl.cache.Start(ctx)
+		rl.db = rl.cache
+	}
+
+	return rl, nil
+}
+
+func (rl *RateLimit) Middleware(next http.Handler) http.Handler {
+	return middleware.Rate(next.ServeHTTP, rl.limiter, rl.db, rl.identifier, rl.cost)
+}
+
+// Записывает накопленные в кэше списания и закрывает хранилище лимитера
+func (rl *RateLimit) Close(ctx context.Context) error {
+	if rl.cache != nil {
+		rl.cache.Flush(ctx)
+	}
+	return rl.storage.Close()
+}
@@ -0,0 +1,54 @@
+package reload
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Следит за сигналом SIGHUP и изменением файла конфига и вызывает onReload.
+// Изменение файла определяется по времени модификации и размеру, interval 0 выключает проверку файла
+func Watch(ctx context.Context, log *slog.Logger, path string, interval time.Duration, onReload func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	lastMod, lastSize := stat(log, path)
+	for {
+		select {
+		case <-signals:
+			log.Info("received SIGHUP, reloading config", "path", path)
+			lastMod, lastSize = stat(log, path)
+			onReload()
+		case <-tick:
+			mod, size := stat(log, path)
+			if mod.Equal(lastMod) && size == lastSize {
+				continue
+			}
+			lastMod, lastSize = mod, size
+			log.Info("config file changed, reloading config", "path", path)
+			onReload()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func stat(log *slog.Logger, path string) (time.Time, int64) {
+	info, err := os.Stat(path)
+	if err != nil {
+		log.Error("failed to stat config file", "path", path, "error", err)
+		return time.Time{}, 0
+	}
+	return info.ModTime(), info.Size()
+}
@@ -2,101 +2,52 @@ package roundrobin
 
 import (
 	"log/slog"
-	"net"
-	"net/url"
-	"sync"
 	"sync/atomic"
+	"testtask/balancer/adapters/pool"
 	"testtask/balancer/core"
-	"time"
 )
 
 type RoundRobin struct {
+	*pool.Pool
 	log     *slog.Logger
-	mu      sync.RWMutex
-	servers []core.Server
 	current uint64
 }
 
-func NewRoundRobin(log *slog.Logger, servers []core.Server) *RoundRobin {
+func NewRoundRobin(log *slog.Logger, servers []core.Server, checker core.HealthChecker) *RoundRobin {
 	return &RoundRobin{
-		log:     log,
-		servers: servers,
+		Pool: pool.New(servers, checker),
+		log:  log,
 	}
 }
 
-// Добавляем сервер в пул серверов
-func (r *RoundRobin) AddServer(server core.Server) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-	r.servers = append(r.servers, server)
-}
-
 // Атомарно возвращаем индекс следующего сервера и инкрементируем счетчик
 func (r *RoundRobin) GetNextIndex() int {
 	return int(atomic.AddUint64(&r.current, 1))
 }
 
-func (r *RoundRobin) ChangeServerStatus(serverUrl *url.URL, status bool) {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
-
-	for _, server := range r.servers {
-		if server.GetUrl().String() == serverUrl.String() {
-			server.SetStatus(status)
-			break
+// Серверы из exclude пропускаются, например, при повторе запроса после ошибки
+func (r *RoundRobin) GetNextServer(exclude ...core.Server) core.Server {
+	var next core.Server
+	r.Read(func(servers []core.Server) {
+		if len(servers) == 0 {
+			return
 		}
-	}
-}
-
-func (r *RoundRobin) GetNextServer() core.Server {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
-
-	if len(r.servers) == 0 {
-		return nil
-	}
-
-	// Проходим полный "круг" в поиске рабочего сервера
-	idxStart := r.GetNextIndex()
-	idxEnd := len(r.servers) + idxStart
 
-	// В цикле ищем первый сервер, который в рабочем состоянии
-	for i := idxStart; i < idxEnd; i++ {
-		idx := i % len(r.servers)
-		if r.servers[idx].IsWorking() {
-			if i != idxStart {
-				atomic.StoreUint64(&r.current, uint64(idx))
+		// Проходим полный "круг" в поиске рабочего сервера
+		idxStart := r.GetNextIndex()
+		idxEnd := len(servers) + idxStart
+
+		// В цикле ищем первый сервер, который в рабочем состоянии
+		for i := idxStart; i < idxEnd; i++ {
+			idx := i % len(servers)
+			if servers[idx].IsWorking() && !core.ContainsServer(exclude, servers[idx]) {
+				if i != idxStart {
+					atomic.StoreUint64(&r.current, uint64(idx))
+				}
+				next = servers[idx]
+				return
 			}
-			return r.servers[idx]
 		}
-	}
-	return nil
-}
-
-// Метод для проверки состояниий серверов в пуле
-func (r *RoundRobin) HealthCheck() {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
-
-	for _, server := range r.servers {
-		stat := "working"
-		status := r.IsServerWorking(server.GetUrl())
-		server.SetStatus(status)
-		if !status {
-			stat = "failed"
-		}
-		r.log.Info("Server status:", server.GetUrl().String(), stat)
-	}
-}
-
-// Метод для установления соединения с конкретным сервером, чтобы проверить его состояние
-func (r *RoundRobin) IsServerWorking(url *url.URL) bool {
-	timeout := 3 * time.Second
-	conn, err := net.DialTimeout("tcp", url.Host, timeout)
-	if err != nil {
-		r.log.Error("Server failed", "url", url, "error", err)
-		return false
-	}
-	_ = conn.Close()
-	return true
+	})
+	return next
 }
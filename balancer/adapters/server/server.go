@@ -9,17 +9,36 @@ import (
 type Server struct {
 	URL          *url.URL
 	status       uint32
+	draining     uint32
+	connections  int64
+	requests     uint64
+	weight       int64
 	ReverseProxy *httputil.ReverseProxy
 }
 
-func NewServer(url *url.URL, proxy *httputil.ReverseProxy) *Server {
+func NewServer(url *url.URL, proxy *httputil.ReverseProxy, weight int) *Server {
+	if weight <= 0 {
+		weight = 1
+	}
 	return &Server{
 		URL:          url,
 		status:       1,
+		weight:       int64(weight),
 		ReverseProxy: proxy,
 	}
 }
 
+// Создает сервер с reverse proxy по строке адреса
+func NewServerFromURL(rawURL string, weight int) (*Server, error) {
+	serverURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	proxy := httputil.NewSingleHostReverseProxy(serverURL)
+	return NewServer(serverURL, proxy, weight), nil
+}
+
 func (s *Server) GetUrl() *url.URL {
 	return s.URL
 }
@@ -28,6 +47,16 @@ func (s *Server) GetReverseProxy() *httputil.ReverseProxy {
 	return s.ReverseProxy
 }
 
+// Возвращает вес сервера для взвешенной балансировки
+func (s *Server) GetWeight() int {
+	return int(atomic.LoadInt64(&s.weight))
+}
+
+// Меняет вес сервера на лету, вес меньше 1 считается равным 1
+func (s *Server) SetWeight(weight int) {
+	atomic.StoreInt64(&s.weight, int64(max(weight, 1)))
+}
+
 // Установить статус серверу, 1 - рабочий, 0 - нет
 func (s *Server) SetStatus(status bool) {
 	var val uint32 = 0
@@ -37,7 +66,46 @@ func (s *Server) SetStatus(status bool) {
 	atomic.StoreUint32(&s.status, val)
 }
 
-// Возвращает true если сервер рабочий, иначе false
+// Возвращает true если сервер прошел проверку состояния
+func (s *Server) IsHealthy() bool {
+	return atomic.LoadUint32(&s.status) == 1
+}
+
+// Включает или выключает вывод сервера из работы: новые запросы не приходят, текущие дорабатывают
+func (s *Server) SetDraining(draining bool) {
+	var val uint32 = 0
+	if draining {
+		val = 1
+	}
+	atomic.StoreUint32(&s.draining, val)
+}
+
+func (s *Server) IsDraining() bool {
+	return atomic.LoadUint32(&s.draining) == 1
+}
+
+// Возвращает true если сервер рабочий и может принимать новые запросы, иначе false
 func (b *Server) IsWorking() bool {
-	return atomic.LoadUint32(&b.status) == 1
+	return b.IsHealthy() && !b.IsDraining()
+}
+
+// Увеличивает счетчики активных и всех запросов к серверу
+func (s *Server) AddConnection() {
+	atomic.AddInt64(&s.connections, 1)
+	atomic.AddUint64(&s.requests, 1)
+}
+
+// Уменьшает счетчик активных запросов к серверу
+func (s *Server) DoneConnection() {
+	atomic.AddInt64(&s.connections, -1)
+}
+
+// Возвращает количество запросов, которые сервер обрабатывает в данный момент
+func (s *Server) GetConnections() int64 {
+	return atomic.LoadInt64(&s.connections)
+}
+
+// Возвращает общее количество запросов, отправленных на сервер
+func (s *Server) GetTotalRequests() uint64 {
+	return atomic.LoadUint64(&s.requests)
 }
@@ -0,0 +1,101 @@
+package weighted
+
+import (
+	"log/slog"
+	"net/url"
+	"slices"
+	"sync"
+	"testtask/balancer/adapters/pool"
+	"testtask/balancer/core"
+)
+
+// Плавный взвешенный round robin (как в nginx): на каждом шаге текущий вес каждого рабочего сервера
+// увеличивается на его вес, выбирается сервер с наибольшим текущим весом, и из его веса вычитается сумма весов.
+// Так сервер с весом 4 получает 4 запроса из 7 при весах 1, 2, 4, но запросы к нему не идут подряд
+type WeightedRoundRobin struct {
+	*pool.Pool
+	log *slog.Logger
+	// Текущие веса серверов. Выбор меняет их, поэтому кроме блокировки пула нужна своя
+	mu      sync.Mutex
+	current map[core.Server]int
+}
+
+func NewWeightedRoundRobin(log *slog.Logger, servers []core.Server, checker core.HealthChecker) *WeightedRoundRobin {
+	w := &WeightedRoundRobin{
+		Pool:    pool.New(servers, checker),
+		log:     log,
+		current: make(map[core.Server]int),
+	}
+	w.OnChange(w.forget)
+	return w
+}
+
+// Удаляет текущие веса серверов, которых больше нет в пуле. При смене веса накопленный текущий вес сохраняется
+func (w *WeightedRoundRobin) forget(servers []core.Server) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for server := range w.current {
+		if !slices.Contains(servers, server) {
+			delete(w.current, server)
+		}
+	}
+}
+
+// Возвращаем индекс следующего сервера с учетом весов, -1 если рабочих серверов нет
+func (w *WeightedRoundRobin) GetNextIndex() int {
+	idx := -1
+	w.Read(func(servers []core.Server) {
+		idx = w.nextIndex(servers, nil)
+	})
+	return idx
+}
+
+func (w *WeightedRoundRobin) nextIndex(servers []core.Server, exclude []core.Server) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	best := -1
+	total := 0
+
+	for i, server := range servers {
+		if !server.IsWorking() || core.ContainsServer(exclude, server) {
+			continue
+		}
+		weight := server.GetWeight()
+		w.current[server] += weight
+		total += weight
+		if best == -1 || w.current[server] > w.current[servers[best]] {
+			best = i
+		}
+	}
+
+	if best != -1 {
+		w.current[servers[best]] -= total
+	}
+	return best
+}
+
+func (w *WeightedRoundRobin) ChangeServerStatus(serverUrl *url.URL, status bool) {
+	w.Pool.ChangeServerStatus(serverUrl, status)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	// Сбрасываем накопленный вес, чтобы вернувшийся сервер не получил пачку запросов подряд
+	for server := range w.current {
+		if server.GetUrl().String() == serverUrl.String() {
+			delete(w.current, server)
+		}
+	}
+}
+
+// Серверы из exclude пропускаются, например, при повторе запроса после ошибки
+func (w *WeightedRoundRobin) GetNextServer(exclude ...core.Server) core.Server {
+	var next core.Server
+	w.Read(func(servers []core.Server) {
+		if idx := w.nextIndex(servers, exclude); idx != -1 {
+			next = servers[idx]
+		}
+	})
+	return next
+}
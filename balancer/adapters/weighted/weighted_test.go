@@ -0,0 +1,78 @@
+package weighted
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"testtask/balancer/adapters/server"
+	"testtask/balancer/core"
+)
+
+func newPool(t *testing.T, weights map[string]int) *WeightedRoundRobin {
+	t.Helper()
+	w := NewWeightedRoundRobin(slog.New(slog.NewTextHandler(io.Discard, nil)), nil, nil)
+	for _, rawURL := range []string{"http://a", "http://b", "http://c"} {
+		s, err := server.NewServerFromURL(rawURL, weights[rawURL])
+		if err != nil {
+			t.Fatalf("new server: %v", err)
+		}
+		w.AddServer(s)
+	}
+	return w
+}
+
+func count(w *WeightedRoundRobin, n int) map[string]int {
+	got := make(map[string]int)
+	for range n {
+		if s := w.GetNextServer(); s != nil {
+			got[s.GetUrl().String()]++
+		}
+	}
+	return got
+}
+
+// За 7 запросов при весах 1, 2, 4 каждый сервер получает столько запросов, каков его вес
+func TestWeights(t *testing.T) {
+	w := newPool(t, map[string]int{"http://a": 1, "http://b": 2, "http://c": 4})
+
+	got := count(w, 7)
+	if got["http://a"] != 1 || got["http://b"] != 2 || got["http://c"] != 4 {
+		t.Fatalf("distribution %v, want 1, 2 and 4", got)
+	}
+
+	var c core.Server
+	for _, s := range w.GetServers() {
+		if s.GetUrl().String() == "http://c" {
+			c = s
+		}
+	}
+	if !w.RemoveServer(c.GetUrl()) {
+		t.Fatal("remove server: not found")
+	}
+	if len(w.current) != 2 {
+		t.Fatalf("current weights %v, want only servers in the pool", w.current)
+	}
+	got = count(w, 3)
+	if got["http://a"] != 1 || got["http://b"] != 2 {
+		t.Fatalf("distribution after remove %v, want 1 and 2", got)
+	}
+}
+
+// Выключенный сервер не получает запросов, а вернувшийся начинает с нулевым текущим весом
+func TestChangeServerStatus(t *testing.T) {
+	w := newPool(t, map[string]int{"http://a": 1, "http://b": 1, "http://c": 1})
+	servers := w.GetServers()
+
+	w.ChangeServerStatus(servers[0].GetUrl(), false)
+	if got := count(w, 4); got["http://a"] != 0 || got["http://b"] != 2 || got["http://c"] != 2 {
+		t.Fatalf("distribution %v, want no requests to http://a", got)
+	}
+
+	w.ChangeServerStatus(servers[0].GetUrl(), true)
+	if _, ok := w.current[servers[0]]; ok {
+		t.Fatal("current weight was not reset")
+	}
+	if got := count(w, 3); got["http://a"] != 1 || got["http://b"] != 1 || got["http://c"] != 1 {
+		t.Fatalf("distribution %v, want 1 request to each server", got)
+	}
+}
@@ -1,28 +1,208 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"net/url"
+	"strings"
+	limiterconfig "testtask/limiter/config"
 	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
+const defaultServersURLs = "http://localhost:8081,http://localhost:8082"
+
 type HTTPConfig struct {
-	Address string        `yaml:"address" env:"HTTP_ADDRESS" env-default:":8080"`
-	Timeout time.Duration `yaml:"timeout" env:"API_TIMEOUT" env-default:"5s"`
+	Address         string        `yaml:"address" env:"HTTP_ADDRESS" env-default:":8080"`
+	Timeout         time.Duration `yaml:"timeout" env:"API_TIMEOUT" env-default:"5s"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" env-default:"30s"`
+}
+
+// Описание бэкенда в конфиге: адрес и вес для взвешенной балансировки
+type ServerConfig struct {
+	URL    string `yaml:"url"`
+	Weight int    `yaml:"weight"`
+}
+
+// Настройки активной проверки состояния серверов
+type HealthCheckConfig struct {
+	Type             string        `yaml:"type" env:"HEALTHCHECK_TYPE" env-default:"tcp"`
+	Path             string        `yaml:"path" env:"HEALTHCHECK_PATH" env-default:"/"`
+	Method           string        `yaml:"method" env:"HEALTHCHECK_METHOD" env-default:"GET"`
+	ExpectedStatuses []int         `yaml:"expected_statuses" env:"HEALTHCHECK_EXPECTED_STATUSES"`
+	BodyMatch        string        `yaml:"body_match" env:"HEALTHCHECK_BODY_MATCH"`
+	Timeout          time.Duration `yaml:"timeout" env:"HEALTHCHECK_TIMEOUT" env-default:"3s"`
+	Rise             int           `yaml:"rise" env:"HEALTHCHECK_RISE" env-default:"1"`
+	Fall             int           `yaml:"fall" env:"HEALTHCHECK_FALL" env-default:"1"`
+}
+
+// Настройки пассивной проверки серверов по ошибкам проксирования и ответам 5xx
+type PassiveHealthCheckConfig struct {
+	Enabled    bool          `yaml:"enabled" env:"PASSIVE_HEALTHCHECK_ENABLED" env-default:"true"`
+	MaxFails   int           `yaml:"max_fails" env:"PASSIVE_HEALTHCHECK_MAX_FAILS" env-default:"3"`
+	FailWindow time.Duration `yaml:"fail_window" env:"PASSIVE_HEALTHCHECK_FAIL_WINDOW" env-default:"10s"`
+}
+
+// Настройки повтора запроса на другом сервере при ошибке соединения
+type RetryConfig struct {
+	MaxAttempts int      `yaml:"max_attempts" env:"RETRY_MAX_ATTEMPTS" env-default:"3"`
+	Methods     []string `yaml:"methods" env:"RETRY_METHODS" env-default:"GET,HEAD,OPTIONS,TRACE,PUT,DELETE"`
+	MaxBodySize int64    `yaml:"max_body_size" env:"RETRY_MAX_BODY_SIZE" env-default:"1048576"`
+}
+
+// Настройки привязки клиента к серверу: mode пустой (без привязки), cookie или header
+type AffinityConfig struct {
+	Mode       string        `yaml:"mode" env:"AFFINITY_MODE"`
+	CookieName string        `yaml:"cookie_name" env:"AFFINITY_COOKIE_NAME" env-default:"lb_affinity"`
+	CookieTTL  time.Duration `yaml:"cookie_ttl" env:"AFFINITY_COOKIE_TTL" env-default:"1h"`
+	Secret     string        `yaml:"secret" env:"AFFINITY_SECRET"`
+	Header     string        `yaml:"header" env:"AFFINITY_HEADER" env-default:"X-Session-ID"`
+}
+
+// Настройки пула consistent hashing: откуда брать ключ (ip, header, path, query),
+// число виртуальных узлов на единицу веса и коэффициент ограничения нагрузки (0 - без ограничения)
+type ConsistentHashConfig struct {
+	Key          string  `yaml:"key" env:"CONSISTENT_HASH_KEY" env-default:"ip"`
+	Name         string  `yaml:"name" env:"CONSISTENT_HASH_NAME"`
+	PathSegments int     `yaml:"path_segments" env:"CONSISTENT_HASH_PATH_SEGMENTS" env-default:"1"`
+	Replicas     int     `yaml:"replicas" env:"CONSISTENT_HASH_REPLICAS" env-default:"100"`
+	LoadFactor   float64 `yaml:"load_factor" env:"CONSISTENT_HASH_LOAD_FACTOR" env-default:"1.25"`
+}
+
+// Перезагрузка конфига: кроме SIGHUP файл проверяется на изменения с интервалом watch_interval, 0 выключает проверку
+type ReloadConfig struct {
+	WatchInterval time.Duration `yaml:"watch_interval" env:"RELOAD_WATCH_INTERVAL" env-default:"5s"`
+}
+
+// Адрес admin API, пустая строка выключает его
+type AdminConfig struct {
+	Address string `yaml:"address" env:"ADMIN_ADDRESS" env-default:"localhost:9090"`
+}
+
+// Цепочка middleware, через которую проходит запрос перед проксированием, в порядке chain.
+// Доступные middleware: ratelimit
+type MiddlewareConfig struct {
+	Chain     []string                  `yaml:"chain" env:"MIDDLEWARE_CHAIN"`
+	RateLimit RateLimitMiddlewareConfig `yaml:"ratelimit" env-prefix:"RATELIMIT_"`
+}
+
+// Лимитер из пакета limiter, встроенный в балансировщик. Настройки те же, что в конфиге лимитера,
+// переменные окружения - с префиксом RATELIMIT_
+type RateLimitMiddlewareConfig struct {
+	DBAddress string                       `yaml:"db_address" env:"DB_ADDRESS"`
+	RateLimit limiterconfig.RateLimit      `yaml:"ratelimiter"`
+	Identity  limiterconfig.IdentityConfig `yaml:"identity"`
+	Cost      limiterconfig.CostConfig     `yaml:"cost"`
+	Storage   limiterconfig.StorageConfig  `yaml:"storage"`
 }
 
 type Config struct {
-	LogLevel            string        `yaml:"log_level" env:"LOG_LEVEL" env-default:"DEBUG"`
-	ServersURLs         string        `yaml:"servers_urls" env:"SERVERS_URLS" env-default:"http://localhost:8081,http://localhost:8082"`
-	HealthCheckInterval time.Duration `yaml:"healthcheck_interval" env:"HEALTHCHECK_INTERVAL" env-default:"120s"`
-	HTTPConfig          HTTPConfig    `yaml:"http"`
+	LogLevel            string                   `yaml:"log_level" env:"LOG_LEVEL" env-default:"DEBUG"`
+	ServersURLs         string                   `yaml:"servers_urls" env:"SERVERS_URLS"`
+	Servers             []ServerConfig           `yaml:"servers"`
+	Algorithm           string                   `yaml:"algorithm" env:"ALGORITHM" env-default:"round_robin"`
+	ConsistentHash      ConsistentHashConfig     `yaml:"consistent_hash"`
+	HealthCheckInterval time.Duration            `yaml:"healthcheck_interval" env:"HEALTHCHECK_INTERVAL" env-default:"120s"`
+	HealthCheck         HealthCheckConfig        `yaml:"healthcheck"`
+	PassiveHealthCheck  PassiveHealthCheckConfig `yaml:"passive_healthcheck"`
+	Retry               RetryConfig              `yaml:"retry"`
+	Affinity            AffinityConfig           `yaml:"affinity"`
+	Reload              ReloadConfig             `yaml:"reload"`
+	Admin               AdminConfig              `yaml:"admin"`
+	Middleware          MiddlewareConfig         `yaml:"middleware"`
+	HTTPConfig          HTTPConfig               `yaml:"http"`
 }
 
 func MustLoad(configPath string) Config {
-	var cfg Config
-	if err := cleanenv.ReadConfig(configPath, &cfg); err != nil {
+	cfg, err := Load(configPath)
+	if err != nil {
 		log.Fatalf("cannot read config %q: %s", configPath, err)
 	}
 	return cfg
 }
+
+// Читает и проверяет конфиг, используется при старте и при перезагрузке конфига
+func Load(configPath string) (Config, error) {
+	var cfg Config
+	if err := cleanenv.ReadConfig(configPath, &cfg); err != nil {
+		return Config{}, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// Проверяет значения, которые cleanenv не может проверить сам
+func (c Config) Validate() error {
+	servers := c.GetServers()
+	if len(servers) == 0 {
+		return errors.New("no servers configured")
+	}
+	for _, s := range servers {
+		if err := ValidateServerURL(s.URL); err != nil {
+			return err
+		}
+	}
+
+	if c.HealthCheckInterval <= 0 {
+		return errors.New("healthcheck_interval must be positive")
+	}
+	if c.HealthCheck.Type != "tcp" && c.HealthCheck.Type != "http" {
+		return fmt.Errorf("unknown healthcheck type: %q", c.HealthCheck.Type)
+	}
+	if c.HealthCheck.Timeout <= 0 {
+		return errors.New("healthcheck timeout must be positive")
+	}
+
+	for _, name := range c.Middleware.Chain {
+		if name != "ratelimit" {
+			return fmt.Errorf("unknown middleware: %q", name)
+		}
+	}
+
+	return nil
+}
+
+// Адрес бэкенда должен быть абсолютным http(s) URL, используется и для конфига, и для admin API
+func ValidateServerURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid server url %q: %w", rawURL, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid server url %q: scheme and host are required", rawURL)
+	}
+	return nil
+}
+
+// Возвращает список бэкендов. Строка servers_urls (или SERVERS_URLS) имеет приоритет, все адреса из нее получают вес 1.
+// Если она не задана, используется структурированный список servers с весами
+func (c Config) GetServers() []ServerConfig {
+	urls := c.ServersURLs
+	if urls == "" {
+		if len(c.Servers) > 0 {
+			servers := make([]ServerConfig, 0, len(c.Servers))
+			for _, s := range c.Servers {
+				if s.Weight <= 0 {
+					s.Weight = 1
+				}
+				servers = append(servers, s)
+			}
+			return servers
+		}
+		urls = defaultServersURLs
+	}
+
+	var servers []ServerConfig
+	for _, u := range strings.Split(urls, ",") {
+		u = strings.TrimSpace(u)
+		if u == "" {
+			continue
+		}
+		servers = append(servers, ServerConfig{URL: u, Weight: 1})
+	}
+	return servers
+}
@@ -0,0 +1,143 @@
+package core
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	AffinityCookie = "cookie"
+	AffinityHeader = "header"
+)
+
+// Настройки привязки клиента к серверу
+type AffinityPolicy struct {
+	// Пустая строка - без привязки, AffinityCookie - подписанная cookie, AffinityHeader - хеш значения заголовка
+	Mode       string
+	CookieName string
+	CookieTTL  time.Duration
+	Secret     []byte
+	Header     string
+}
+
+// Выбирает сервер для попытки с учетом привязки клиента. Если закрепленный сервер не работает
+// или уже пробовали, запрос уходит на другой сервер, а клиент будет закреплен за ним
+func (lb *LoadBalancer) nextServer(r *http.Request, tried []Server) Server {
+	switch lb.affinity.Mode {
+	case AffinityHeader:
+		if key := r.Header.Get(lb.affinity.Header); key != "" {
+			return lb.hashServer(key, tried)
+		}
+	case AffinityCookie:
+		server := lb.cookieServer(r)
+		if server != nil && server.IsWorking() && !ContainsServer(tried, server) {
+			return server
+		}
+	}
+
+	if pool, ok := lb.serverPool.(RequestPooler); ok {
+		return pool.GetServerForRequest(r, tried...)
+	}
+	return lb.serverPool.GetNextServer(tried...)
+}
+
+// Rendezvous hashing: для ключа выбирается рабочий сервер с максимальным хешем от пары ключ-сервер.
+// Если сервер выпадает, его клиенты расходятся по остальным, а клиенты других серверов не переезжают
+func (lb *LoadBalancer) hashServer(key string, tried []Server) Server {
+	var best Server
+	var bestScore uint64
+
+	for _, server := range lb.serverPool.GetServers() {
+		if !server.IsWorking() || ContainsServer(tried, server) {
+			continue
+		}
+		sum := sha256.Sum256([]byte(key + "|" + server.GetUrl().String()))
+		score := binary.BigEndian.Uint64(sum[:8])
+		if best == nil || score > bestScore {
+			best = server
+			bestScore = score
+		}
+	}
+	return best
+}
+
+// Возвращает сервер из подписанной cookie клиента, nil если cookie нет или подпись неверна
+func (lb *LoadBalancer) cookieServer(r *http.Request) Server {
+	cookie, err := r.Cookie(lb.affinity.CookieName)
+	if err != nil {
+		return nil
+	}
+
+	serverURL, ok := lb.verifyCookie(cookie.Value)
+	if !ok {
+		return nil
+	}
+
+	for _, server := range lb.serverPool.GetServers() {
+		if server.GetUrl().String() == serverURL {
+			return server
+		}
+	}
+	return nil
+}
+
+// Добавляет в ответ cookie с сервером, если клиент еще не закреплен за ним
+func (lb *LoadBalancer) pinServer(resp *http.Response, server Server) {
+	if lb.affinity.Mode != AffinityCookie {
+		return
+	}
+
+	serverURL := server.GetUrl().String()
+	if cookie, err := resp.Request.Cookie(lb.affinity.CookieName); err == nil {
+		if pinned, ok := lb.verifyCookie(cookie.Value); ok && pinned == serverURL {
+			return
+		}
+	}
+
+	cookie := &http.Cookie{
+		Name:     lb.affinity.CookieName,
+		Value:    lb.signCookie(serverURL),
+		Path:     "/",
+		MaxAge:   int(lb.affinity.CookieTTL.Seconds()),
+		HttpOnly: true,
+	}
+	resp.Header.Add("Set-Cookie", cookie.String())
+}
+
+// Значение cookie: base64(url).base64(hmac-sha256(url))
+func (lb *LoadBalancer) signCookie(serverURL string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(serverURL)) + "." +
+		base64.RawURLEncoding.EncodeToString(lb.mac(serverURL))
+}
+
+func (lb *LoadBalancer) verifyCookie(value string) (string, bool) {
+	encodedURL, encodedMAC, found := strings.Cut(value, ".")
+	if !found {
+		return "", false
+	}
+
+	serverURL, err := base64.RawURLEncoding.DecodeString(encodedURL)
+	if err != nil {
+		return "", false
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(encodedMAC)
+	if err != nil {
+		return "", false
+	}
+
+	if !hmac.Equal(mac, lb.mac(string(serverURL))) {
+		return "", false
+	}
+	return string(serverURL), true
+}
+
+func (lb *LoadBalancer) mac(serverURL string) []byte {
+	h := hmac.New(sha256.New, lb.affinity.Secret)
+	h.Write([]byte(serverURL))
+	return h.Sum(nil)
+}
@@ -3,5 +3,8 @@ package core
 import "errors"
 
 var (
-	ErrNoBackends = errors.New("no backends provided")
+	ErrNoBackends     = errors.New("no backends provided")
+	ErrServerExists   = errors.New("server already exists")
+	ErrServerNotFound = errors.New("server was not found")
+	ErrInvalidServer  = errors.New("server has nil URL")
 )
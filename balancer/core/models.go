@@ -0,0 +1,47 @@
+package core
+
+import "net/http"
+
+// Политика повторов запроса на другом сервере при ошибке соединения
+type RetryPolicy struct {
+	// Общее число попыток, включая первую. 1 и меньше - без повторов
+	MaxAttempts int
+	// Методы, которые можно повторять, обычно только идемпотентные
+	Methods []string
+	// Максимальный размер тела, которое буферизуется для повтора. Запросы с большим телом не повторяются
+	MaxBodySize int64
+}
+
+// Проверяет, есть ли сервер в списке, сравнение идет по URL
+func ContainsServer(servers []Server, server Server) bool {
+	for _, s := range servers {
+		if s.GetUrl().String() == server.GetUrl().String() {
+			return true
+		}
+	}
+	return false
+}
+
+// Описание сервера для admin API
+type ServerInfo struct {
+	URL               string `json:"url"`
+	Weight            int    `json:"weight"`
+	Healthy           bool   `json:"healthy"`
+	Draining          bool   `json:"draining"`
+	ActiveConnections int64  `json:"active_connections"`
+	TotalRequests     uint64 `json:"total_requests"`
+}
+
+type ServerRequest struct {
+	URL      string `json:"url"`
+	Weight   int    `json:"weight"`
+	Draining bool   `json:"draining"`
+}
+
+// Собирает цепочку: первый middleware получает запрос первым
+func Chain(handler http.Handler, middlewares ...Middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
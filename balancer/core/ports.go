@@ -1,24 +1,69 @@
 package core
 
 import (
+	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"time"
 )
 
 type Server interface {
 	SetStatus(bool)
+	IsHealthy() bool
+	SetDraining(bool)
+	IsDraining() bool
 	IsWorking() bool
 	GetUrl() *url.URL
 	GetReverseProxy() *httputil.ReverseProxy
+	GetWeight() int
+	SetWeight(int)
+	AddConnection()
+	DoneConnection()
+	GetConnections() int64
+	GetTotalRequests() uint64
 }
 
 // Благодаря использованию интерфейсов предусмотрена возможность замены алгоритма балансировщика
 // Для использования балансировщика с алгоритмом least connections (или другим) достаточно будет реализовать каждый из методов интерфейса
 type Pooler interface {
-	AddServer(Server)
+	// Возвращает false, если сервер с таким URL уже есть в пуле. Проверка и добавление атомарны
+	AddServer(Server) bool
+	RemoveServer(*url.URL) bool
+	// Меняет вес сервера без удаления из пула, возвращает false если сервера нет
+	UpdateServerWeight(*url.URL, int) bool
 	GetNextIndex() int
 	ChangeServerStatus(*url.URL, bool)
-	GetNextServer() Server
+	GetNextServer(exclude ...Server) Server
+	GetServers() []Server
 	HealthCheck()
 	IsServerWorking(*url.URL) bool
 }
+
+// Пул, которому для выбора сервера нужен сам запрос (например, consistent hashing по ключу запроса).
+// Если пул реализует этот интерфейс, балансировщик вызывает GetServerForRequest вместо GetNextServer
+type RequestPooler interface {
+	Pooler
+	GetServerForRequest(r *http.Request, exclude ...Server) Server
+}
+
+// Проверка состояния отдельного сервера. Реализация решает, каким способом проверять сервер (tcp, http)
+// и после скольких проверок подряд менять его статус
+type HealthChecker interface {
+	Check(Server)
+	IsServerWorking(*url.URL) bool
+}
+
+// Пассивная проверка состояния: балансировщик сообщает об ошибках проксирования на конкретный сервер
+type PassiveChecker interface {
+	ReportFailure(Server)
+}
+
+// Метрики балансировщика: результаты проксирования, healthcheck и отказы из-за отсутствия рабочих серверов
+type Metrics interface {
+	ObserveRequest(Server, int, time.Duration)
+	ObserveHealthCheck(Server, bool)
+	NoBackendAvailable()
+}
+
+// Обработчик, через который запрос проходит до балансировщика: может ответить сам (например, 429) или передать запрос дальше
+type Middleware func(http.Handler) http.Handler
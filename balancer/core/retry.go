@@ -0,0 +1,75 @@
+package core
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+type attemptKey struct{}
+
+// Состояние одной попытки проксирования. Если повтор разрешен, ErrorHandler прокси не пишет ответ клиенту,
+// а сохраняет ошибку, чтобы балансировщик мог отправить запрос на другой сервер
+type attempt struct {
+	retryable bool
+	err       error
+}
+
+// Обертка над ResponseWriter, которая запоминает, начали ли мы уже отвечать клиенту и с каким кодом
+type responseTracker struct {
+	http.ResponseWriter
+	written bool
+	status  int
+}
+
+func (t *responseTracker) WriteHeader(code int) {
+	if !t.written {
+		t.status = code
+	}
+	t.written = true
+	t.ResponseWriter.WriteHeader(code)
+}
+
+func (t *responseTracker) Write(b []byte) (int, error) {
+	if !t.written {
+		t.status = http.StatusOK
+	}
+	t.written = true
+	return t.ResponseWriter.Write(b)
+}
+
+// Нужен для http.ResponseController, через который ReverseProxy сбрасывает буфер при стриминге
+func (t *responseTracker) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
+
+func (p RetryPolicy) allowsMethod(method string) bool {
+	return slices.ContainsFunc(p.Methods, func(m string) bool {
+		return strings.EqualFold(strings.TrimSpace(m), method)
+	})
+}
+
+// Читает тело запроса в память, чтобы его можно было отправить повторно.
+// Если тело больше лимита, возвращает false и восстанавливает тело запроса без буферизации
+func (p RetryPolicy) bufferBody(r *http.Request) ([]byte, bool, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, true, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, p.MaxBodySize+1))
+	if err != nil {
+		return nil, false, err
+	}
+
+	if int64(len(body)) > p.MaxBodySize {
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		return nil, false, nil
+	}
+
+	return body, true, nil
+}
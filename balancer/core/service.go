@@ -1,39 +1,127 @@
 package core
 
 import (
+	"bytes"
+	"context"
+	"io"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"slices"
+	"sync"
 	"time"
 )
 
 type LoadBalancer struct {
-	log        *slog.Logger
-	serverPool Pooler
+	log          *slog.Logger
+	serverPool   Pooler
+	passive      PassiveChecker
+	retry        RetryPolicy
+	affinity     AffinityPolicy
+	metrics      Metrics
+	mu           sync.Mutex
+	healthTicker *time.Ticker
+	// URL серверов из конфига. SyncServers меняет только их, серверы, добавленные через admin API, остаются в пуле
+	configured map[string]bool
 }
 
-func NewLoadBalancer(log *slog.Logger, pool Pooler) *LoadBalancer {
+// passive может быть nil, тогда ошибки проксирования не влияют на статус серверов
+func NewLoadBalancer(log *slog.Logger, pool Pooler, passive PassiveChecker, retry RetryPolicy, affinity AffinityPolicy, metrics Metrics) *LoadBalancer {
 	return &LoadBalancer{
 		serverPool: pool,
 		log:        log,
+		passive:    passive,
+		retry:      retry,
+		affinity:   affinity,
+		metrics:    metrics,
+		configured: make(map[string]bool),
 	}
 }
 
 func (lb *LoadBalancer) Handler(w http.ResponseWriter, r *http.Request) {
-	server := lb.serverPool.GetNextServer()
-	if server != nil {
-		server.GetReverseProxy().ServeHTTP(w, r)
+	var body []byte
+	retryable := lb.retry.MaxAttempts > 1 && lb.retry.allowsMethod(r.Method)
+	if retryable {
+		var err error
+		body, retryable, err = lb.retry.bufferBody(r)
+		if err != nil {
+			lb.log.Error("failed to read request body", "error", err)
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Каждая следующая попытка уходит на сервер, который еще не пробовали
+	var tried []Server
+	for attempt := 1; ; attempt++ {
+		server := lb.nextServer(r, tried)
+		if server == nil {
+			break
+		}
+
+		canRetry := retryable && attempt < lb.retry.MaxAttempts
+		if lb.serve(server, w, r, body, canRetry) {
+			return
+		}
+
+		tried = append(tried, server)
+		lb.log.Warn("retrying request on another server", "failed_url", server.GetUrl().String(), "attempt", attempt)
+	}
+
+	if len(tried) > 0 {
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
 		return
 	}
+	lb.metrics.NoBackendAvailable()
 	http.Error(w, "Server not available", http.StatusServiceUnavailable)
 }
 
-func (lb *LoadBalancer) StartHealthCheck(interval time.Duration) {
+// Проксирует запрос на сервер. Возвращает false, если запрос не дошел до сервера, клиенту еще ничего не отправлено
+// и его можно повторить на другом сервере
+func (lb *LoadBalancer) serve(server Server, w http.ResponseWriter, r *http.Request, body []byte, canRetry bool) bool {
+	// Считаем активные запросы к серверу, это нужно для алгоритма least connections
+	server.AddConnection()
+	defer server.DoneConnection()
+
+	if body != nil {
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	state := &attempt{retryable: canRetry}
+	tracker := &responseTracker{ResponseWriter: w}
+	ctx := context.WithValue(r.Context(), attemptKey{}, state)
+	start := time.Now()
+	server.GetReverseProxy().ServeHTTP(tracker, r.WithContext(ctx))
+
+	// Неудачную попытку, после которой будет повтор, считаем как 502, который получил бы клиент
+	status := tracker.status
+	if !tracker.written {
+		status = http.StatusBadGateway
+	}
+	lb.metrics.ObserveRequest(server, status, time.Since(start))
+
+	return state.err == nil || tracker.written
+}
+
+// Запускает healthcheck в фоне, проверки останавливаются при отмене контекста
+func (lb *LoadBalancer) StartHealthCheck(ctx context.Context, interval time.Duration) {
 	ticker := time.NewTicker(interval)
+	lb.mu.Lock()
+	lb.healthTicker = ticker
+	lb.mu.Unlock()
+
 	go func() {
-		for range ticker.C {
-			lb.log.Info("Starting health check")
-			lb.serverPool.HealthCheck()
-			lb.log.Info("Health check completed")
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				lb.log.Info("Starting health check")
+				lb.serverPool.HealthCheck()
+				lb.log.Info("Health check completed")
+			case <-ctx.Done():
+				lb.log.Info("stop health check")
+				return
+			}
 		}
 	}()
 }
@@ -43,15 +131,161 @@ func (lb *LoadBalancer) Initialize(servers []Server) error {
 		return ErrNoBackends
 	}
 
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	for _, server := range servers {
+		lb.configured[server.GetUrl().String()] = true
+		if err := lb.AddServer(server); err != nil {
+			lb.log.Error("Failed to add server", "error", err)
+		}
+	}
+
+	return nil
+}
+
+// Меняет интервал healthcheck на лету, например после перезагрузки конфига
+func (lb *LoadBalancer) SetHealthCheckInterval(interval time.Duration) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	if lb.healthTicker != nil {
+		lb.healthTicker.Reset(interval)
+	}
+}
+
+// Приводит серверы из конфига к заданному списку: добавляет новые, удаляет отсутствующие
+// и меняет вес оставшихся на месте, не убирая их из пула. Запросы на удаленные серверы дорабатывают.
+// Серверы, добавленные через admin API, не трогаются, если их адреса нет в новом списке.
+// Если адрес есть, сервер считается сервером из конфига и получает вес из него
+func (lb *LoadBalancer) SyncServers(servers []Server) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	for _, old := range lb.serverPool.GetServers() {
+		serverURL := old.GetUrl().String()
+		idx := slices.IndexFunc(servers, func(s Server) bool {
+			return s.GetUrl().String() == serverURL
+		})
+		if idx == -1 {
+			if !lb.configured[serverURL] {
+				lb.log.Info("Keeping server added through admin API", "url", serverURL)
+				continue
+			}
+			if err := lb.RemoveServer(old.GetUrl()); err != nil {
+				lb.log.Error("Failed to remove server", "url", serverURL, "error", err)
+			}
+			continue
+		}
+
+		if weight := servers[idx].GetWeight(); weight != old.GetWeight() {
+			if err := lb.UpdateServerWeight(old.GetUrl(), weight); err != nil {
+				lb.log.Error("Failed to update server weight", "url", serverURL, "error", err)
+			}
+		}
+	}
+
+	configured := make(map[string]bool, len(servers))
+	current := lb.serverPool.GetServers()
 	for _, server := range servers {
-		if server.GetUrl() == nil {
-			lb.log.Error("Server has nil URL")
+		configured[server.GetUrl().String()] = true
+		if ContainsServer(current, server) {
 			continue
 		}
+		if err := lb.AddServer(server); err != nil {
+			lb.log.Error("Failed to add server", "error", err)
+		}
+	}
+	lb.configured = configured
+}
+
+// Добавляет сервер в пул во время работы балансировщика
+func (lb *LoadBalancer) AddServer(server Server) error {
+	if server.GetUrl() == nil {
+		return ErrInvalidServer
+	}
+
+	lb.watchProxy(server)
+	if !lb.serverPool.AddServer(server) {
+		return ErrServerExists
+	}
+	lb.log.Info("Added server to pool", "url", server.GetUrl().String())
+	return nil
+}
 
-		lb.serverPool.AddServer(server)
-		lb.log.Info("Added server to pool", "url", server.GetUrl().String())
+// Удаляет сервер из пула. Запросы, которые уже ушли на сервер, дорабатывают
+func (lb *LoadBalancer) RemoveServer(serverURL *url.URL) error {
+	if !lb.serverPool.RemoveServer(serverURL) {
+		return ErrServerNotFound
 	}
 
+	lb.log.Info("Removed server from pool", "url", serverURL.String())
 	return nil
 }
+
+// Меняет вес сервера в пуле, состояние сервера и его ключи в consistent hashing сохраняются
+func (lb *LoadBalancer) UpdateServerWeight(serverURL *url.URL, weight int) error {
+	if !lb.serverPool.UpdateServerWeight(serverURL, weight) {
+		return ErrServerNotFound
+	}
+
+	lb.log.Info("Changed server weight", "url", serverURL.String(), "weight", weight)
+	return nil
+}
+
+// Включает или выключает вывод сервера из работы: новые запросы на него не идут, текущие дорабатывают
+func (lb *LoadBalancer) DrainServer(serverURL *url.URL, draining bool) error {
+	for _, server := range lb.serverPool.GetServers() {
+		if server.GetUrl().String() == serverURL.String() {
+			server.SetDraining(draining)
+			lb.log.Info("Changed server draining", "url", serverURL.String(), "draining", draining)
+			return nil
+		}
+	}
+	return ErrServerNotFound
+}
+
+// Возвращает серверы пула
+func (lb *LoadBalancer) Servers() []Server {
+	return lb.serverPool.GetServers()
+}
+
+// Подключаемся к обработке ошибок и ответов прокси сервера, чтобы передавать сбои в пассивную проверку
+func (lb *LoadBalancer) watchProxy(server Server) {
+	proxy := server.GetReverseProxy()
+
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		// Клиент отменил запрос или отключился: сервер в этом не виноват, в пассивную проверку не сообщаем
+		if r.Context().Err() != nil {
+			lb.log.Debug("request canceled by client", "url", server.GetUrl().String(), "error", err)
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		lb.log.Error("proxy error", "url", server.GetUrl().String(), "error", err)
+		lb.reportFailure(server)
+
+		// Если клиент еще ждет ответа и повтор разрешен, ответ не пишем, запрос уйдет на другой сервер
+		if state, ok := r.Context().Value(attemptKey{}).(*attempt); ok && state.retryable && r.Context().Err() == nil {
+			state.err = err
+			return
+		}
+		w.WriteHeader(http.StatusBadGateway)
+	}
+
+	modifyResponse := proxy.ModifyResponse
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		if resp.StatusCode >= http.StatusInternalServerError {
+			lb.reportFailure(server)
+		}
+		lb.pinServer(resp, server)
+		if modifyResponse != nil {
+			return modifyResponse(resp)
+		}
+		return nil
+	}
+}
+
+func (lb *LoadBalancer) reportFailure(server Server) {
+	if lb.passive != nil {
+		lb.passive.ReportFailure(server)
+	}
+}
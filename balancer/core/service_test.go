@@ -0,0 +1,127 @@
+package core_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"testtask/balancer/adapters/roundrobin"
+	"testtask/balancer/adapters/server"
+	"testtask/balancer/core"
+	"time"
+)
+
+type passiveStub struct {
+	failures atomic.Int64
+}
+
+func (p *passiveStub) ReportFailure(core.Server) { p.failures.Add(1) }
+
+type metricsStub struct{}
+
+func (metricsStub) ObserveRequest(core.Server, int, time.Duration) {}
+func (metricsStub) ObserveHealthCheck(core.Server, bool)           {}
+func (metricsStub) NoBackendAvailable()                            {}
+
+func newBalancer(t *testing.T, backendURL string) (*core.LoadBalancer, *passiveStub) {
+	t.Helper()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	srv, err := server.NewServerFromURL(backendURL, 1)
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+
+	passive := &passiveStub{}
+	lb := core.NewLoadBalancer(log, roundrobin.NewRoundRobin(log, nil, nil), passive, core.RetryPolicy{MaxAttempts: 1}, core.AffinityPolicy{}, metricsStub{})
+	if err := lb.Initialize([]core.Server{srv}); err != nil {
+		t.Fatalf("initialize: %v", err)
+	}
+	return lb, passive
+}
+
+// Запрос, отмененный клиентом, не считается ошибкой сервера
+func TestCanceledRequestIsNotFailure(t *testing.T) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer backend.Close()
+	defer close(release)
+
+	lb, passive := newBalancer(t, backend.URL)
+
+	for range 3 {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		r := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+		lb.Handler(httptest.NewRecorder(), r)
+		cancel()
+	}
+
+	if got := passive.failures.Load(); got != 0 {
+		t.Fatalf("reported %d failures for canceled requests, want 0", got)
+	}
+}
+
+func TestUnreachableServerIsFailure(t *testing.T) {
+	backend := httptest.NewServer(http.NotFoundHandler())
+	backend.Close()
+
+	lb, passive := newBalancer(t, backend.URL)
+
+	w := httptest.NewRecorder()
+	lb.Handler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if w.Code != http.StatusBadGateway {
+		t.Fatalf("status %d, want %d", w.Code, http.StatusBadGateway)
+	}
+	if got := passive.failures.Load(); got != 1 {
+		t.Fatalf("reported %d failures, want 1", got)
+	}
+}
+
+func urls(lb *core.LoadBalancer) map[string]int {
+	got := make(map[string]int)
+	for _, s := range lb.Servers() {
+		got[s.GetUrl().String()] = s.GetWeight()
+	}
+	return got
+}
+
+func newServer(t *testing.T, rawURL string, weight int) core.Server {
+	t.Helper()
+	srv, err := server.NewServerFromURL(rawURL, weight)
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	return srv
+}
+
+// Перезагрузка конфига меняет только серверы из конфига, серверы из admin API остаются в пуле
+func TestSyncServersKeepsAdminServers(t *testing.T) {
+	lb, _ := newBalancer(t, "http://config-a")
+	if err := lb.AddServer(newServer(t, "http://admin", 1)); err != nil {
+		t.Fatalf("add server: %v", err)
+	}
+
+	lb.SyncServers([]core.Server{newServer(t, "http://config-b", 2)})
+	want := map[string]int{"http://config-b": 2, "http://admin": 1}
+	if got := urls(lb); len(got) != len(want) || got["http://config-b"] != 2 || got["http://admin"] != 1 {
+		t.Fatalf("servers %v, want %v", got, want)
+	}
+
+	// Сервер из admin API, который появился в конфиге, дальше управляется конфигом
+	lb.SyncServers([]core.Server{newServer(t, "http://config-b", 2), newServer(t, "http://admin", 3)})
+	if got := urls(lb); len(got) != 2 || got["http://admin"] != 3 {
+		t.Fatalf("servers %v, want http://admin with weight 3", got)
+	}
+	lb.SyncServers([]core.Server{newServer(t, "http://config-b", 2)})
+	if got := urls(lb); len(got) != 1 || got["http://config-b"] != 2 {
+		t.Fatalf("servers %v, want only http://config-b", got)
+	}
+}
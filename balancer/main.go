@@ -1,15 +1,28 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"errors"
 	"flag"
+	"fmt"
 	"log/slog"
 	"net/http"
-	"net/http/httputil"
-	"net/url"
 	"os"
-	"strings"
+	"os/signal"
+	"reflect"
+	"syscall"
+	"testtask/balancer/adapters/admin"
+	"testtask/balancer/adapters/consistenthash"
+	"testtask/balancer/adapters/healthcheck"
+	"testtask/balancer/adapters/leastconn"
+	"testtask/balancer/adapters/metrics"
+	"testtask/balancer/adapters/passive"
+	"testtask/balancer/adapters/ratelimit"
+	"testtask/balancer/adapters/reload"
 	"testtask/balancer/adapters/roundrobin"
 	"testtask/balancer/adapters/server"
+	"testtask/balancer/adapters/weighted"
 	"testtask/balancer/config"
 	"testtask/balancer/core"
 )
@@ -24,10 +37,37 @@ func main() {
 	log := mustMakeLogger(cfg.LogLevel)
 	log.Info("starting server")
 
+	// Контекст отменяется по SIGINT/SIGTERM, после этого останавливаем фоновые задачи и серверы
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Достаем серверы из конфига
-	servers := createServers(cfg.ServersURLs, log)
-	pool := roundrobin.NewRoundRobin(log, nil)
-	lb := core.NewLoadBalancer(log, pool)
+	servers := createServers(cfg.GetServers(), log)
+	m := metrics.New()
+	checker := healthcheck.New(log, cfg.HealthCheck, m)
+	pool, err := createPool(cfg, log, checker)
+	if err != nil {
+		log.Error("failed to create server pool", "error", err)
+		os.Exit(1)
+	}
+	m.RegisterServers(pool.GetServers)
+
+	// Пассивная проверка выводит сервер из пула по ошибкам живого трафика, не дожидаясь healthcheck
+	var passiveChecker core.PassiveChecker
+	if cfg.PassiveHealthCheck.Enabled {
+		passiveChecker = passive.New(log, pool, cfg.PassiveHealthCheck.MaxFails, cfg.PassiveHealthCheck.FailWindow)
+	}
+	retry := core.RetryPolicy{
+		MaxAttempts: cfg.Retry.MaxAttempts,
+		Methods:     cfg.Retry.Methods,
+		MaxBodySize: cfg.Retry.MaxBodySize,
+	}
+	affinity, err := createAffinity(cfg.Affinity, log)
+	if err != nil {
+		log.Error("failed to configure affinity", "error", err)
+		os.Exit(1)
+	}
+	lb := core.NewLoadBalancer(log, pool, passiveChecker, retry, affinity, m)
 
 	// Инициализируем балансировщик
 	if err := lb.Initialize(servers); err != nil {
@@ -35,23 +75,112 @@ func main() {
 		os.Exit(1)
 	}
 
-	// В горутине запускаем healthcheck для проверки серверов с заданным интервалом
-	go lb.StartHealthCheck(cfg.HealthCheckInterval)
+	// В фоне запускаем healthcheck для проверки серверов с заданным интервалом
+	lb.StartHealthCheck(ctx, cfg.HealthCheckInterval)
+
+	// Цепочка middleware, через которую запрос проходит до проксирования, например встроенный лимитер
+	middlewares, closers, err := createMiddlewares(ctx, log, cfg.Middleware)
+	if err != nil {
+		log.Error("failed to configure middleware", "error", err)
+		os.Exit(1)
+	}
 
 	// Поднимаем сервер
 	mux := http.NewServeMux()
-	mux.HandleFunc("/", lb.Handler)
+	mux.Handle("/", core.Chain(http.HandlerFunc(lb.Handler), middlewares...))
+
+	// Перечитываем конфиг по SIGHUP или при изменении файла и применяем изменения без перезапуска
+	current := cfg
+	go reload.Watch(ctx, log, configPath, cfg.Reload.WatchInterval, func() {
+		newCfg, err := config.Load(configPath)
+		if err != nil {
+			log.Error("config reload rejected, keeping current config", "error", err)
+			return
+		}
+		applyConfig(log, lb, checker, current, newCfg)
+		current = newCfg
+	})
 
-	server := http.Server{
+	// Admin API поднимаем на отдельном адресе, чтобы не открывать его вместе с основным трафиком
+	httpServers := []*http.Server{}
+	if cfg.Admin.Address != "" {
+		httpServers = append(httpServers, startAdminServer(cfg.Admin.Address, log, lb, m, stop))
+	}
+
+	server := &http.Server{
 		Addr:        cfg.HTTPConfig.Address,
 		Handler:     mux,
 		ReadTimeout: cfg.HTTPConfig.Timeout,
 	}
+	httpServers = append(httpServers, server)
+
+	go func() {
+		log.Info("starting server", "address", cfg.HTTPConfig.Address)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error("server error", "error", err)
+			stop()
+		}
+	}()
+
+	<-ctx.Done()
+	log.Info("shutting down server", "timeout", cfg.HTTPConfig.ShutdownTimeout)
+
+	// Перестаем принимать новые соединения и ждем завершения текущих запросов, но не дольше таймаута
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.HTTPConfig.ShutdownTimeout)
+	defer cancel()
+	for _, srv := range httpServers {
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Error("failed to shutdown server", "address", srv.Addr, "error", err)
+		}
+	}
+	for _, closer := range closers {
+		if err := closer(shutdownCtx); err != nil {
+			log.Error("failed to close middleware", "error", err)
+		}
+	}
+	log.Info("server stopped")
+}
+
+// Применяет изменения конфига к работающему балансировщику: пул серверов и настройки healthcheck.
+// Остальные настройки требуют перезапуска
+func applyConfig(log *slog.Logger, lb *core.LoadBalancer, checker *healthcheck.HealthChecker, prev, next config.Config) {
+	lb.SyncServers(createServers(next.GetServers(), log))
+	checker.Update(next.HealthCheck)
+	if next.HealthCheckInterval != prev.HealthCheckInterval {
+		lb.SetHealthCheckInterval(next.HealthCheckInterval)
+	}
+
+	if next.Algorithm != prev.Algorithm || next.HTTPConfig.Address != prev.HTTPConfig.Address || next.Admin.Address != prev.Admin.Address {
+		log.Warn("algorithm and listen addresses are not reloaded, restart is required")
+	}
+	if !reflect.DeepEqual(next.Middleware, prev.Middleware) {
+		log.Warn("middleware is not reloaded, restart is required")
+	}
+	log.Info("config reloaded")
+}
 
-	log.Info("starting server", "address", cfg.HTTPConfig.Address)
-	if err := server.ListenAndServe(); err != nil {
-		log.Error("server error", "error", err)
+func startAdminServer(address string, log *slog.Logger, lb *core.LoadBalancer, m *metrics.Metrics, stop func()) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", m.Handler())
+	mux.HandleFunc("GET /servers", admin.GetServersHandler(lb))
+	mux.HandleFunc("POST /servers", admin.AddServerHandler(log, lb))
+	mux.HandleFunc("DELETE /server", admin.RemoveServerHandler(log, lb))
+	mux.HandleFunc("PUT /server", admin.UpdateServerHandler(log, lb))
+
+	server := &http.Server{
+		Addr:    address,
+		Handler: mux,
 	}
+
+	go func() {
+		log.Info("starting admin server", "address", address)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error("admin server error", "error", err)
+			stop()
+		}
+	}()
+
+	return server
 }
 
 func mustMakeLogger(logLevel string) *slog.Logger {
@@ -70,25 +199,86 @@ func mustMakeLogger(logLevel string) *slog.Logger {
 	return slog.New(handler)
 }
 
-func createServers(serverURLs string, log *slog.Logger) []core.Server {
+func createServers(configs []config.ServerConfig, log *slog.Logger) []core.Server {
 	var servers []core.Server
 
-	urls := strings.Split(serverURLs, ",")
-	for _, u := range urls {
-		u = strings.TrimSpace(u)
-		if u == "" {
+	for _, c := range configs {
+		srv, err := server.NewServerFromURL(c.URL, c.Weight)
+		if err != nil {
+			log.Error("Failed to parse server URL", "url", c.URL, "error", err)
 			continue
 		}
+		servers = append(servers, srv)
+	}
 
-		serverURL, err := url.Parse(u)
-		if err != nil {
-			log.Error("Failed to parse server URL", "url", u, "error", err)
-			continue
+	return servers
+}
+
+// Выбираем алгоритм балансировки по значению из конфига
+func createPool(cfg config.Config, log *slog.Logger, checker core.HealthChecker) (core.Pooler, error) {
+	switch cfg.Algorithm {
+	case "round_robin":
+		return roundrobin.NewRoundRobin(log, nil, checker), nil
+	case "least_connections":
+		return leastconn.NewLeastConn(log, nil, checker), nil
+	case "weighted_round_robin":
+		return weighted.NewWeightedRoundRobin(log, nil, checker), nil
+	case "consistent_hash":
+		return consistenthash.NewConsistentHash(log, nil, checker, cfg.ConsistentHash), nil
+	default:
+		return nil, fmt.Errorf("unknown balancing algorithm: %q", cfg.Algorithm)
+	}
+}
+
+// Собираем цепочку middleware в порядке из конфига. Вместе с цепочкой возвращаются функции,
+// которые нужно вызвать при остановке, например, чтобы закрыть хранилище лимитера
+func createMiddlewares(ctx context.Context, log *slog.Logger, cfg config.MiddlewareConfig) ([]core.Middleware, []func(context.Context) error, error) {
+	var (
+		middlewares []core.Middleware
+		closers     []func(context.Context) error
+	)
+
+	for _, name := range cfg.Chain {
+		switch name {
+		case "ratelimit":
+			rl, err := ratelimit.New(ctx, log, cfg.RateLimit)
+			if err != nil {
+				return nil, nil, err
+			}
+			middlewares = append(middlewares, rl.Middleware)
+			closers = append(closers, rl.Close)
+		default:
+			return nil, nil, fmt.Errorf("unknown middleware: %q", name)
 		}
+	}
 
-		proxy := httputil.NewSingleHostReverseProxy(serverURL)
-		servers = append(servers, server.NewServer(serverURL, proxy))
+	return middlewares, closers, nil
+}
+
+// Собираем настройки привязки клиентов. Без секрета cookie подписываются случайным ключом
+// и перестают действовать после перезапуска балансировщика
+func createAffinity(cfg config.AffinityConfig, log *slog.Logger) (core.AffinityPolicy, error) {
+	policy := core.AffinityPolicy{
+		Mode:       cfg.Mode,
+		CookieName: cfg.CookieName,
+		CookieTTL:  cfg.CookieTTL,
+		Secret:     []byte(cfg.Secret),
+		Header:     cfg.Header,
 	}
 
-	return servers
+	switch cfg.Mode {
+	case "", core.AffinityHeader:
+	case core.AffinityCookie:
+		if len(policy.Secret) == 0 {
+			log.Warn("affinity secret is not set, using random key")
+			policy.Secret = make([]byte, 32)
+			if _, err := rand.Read(policy.Secret); err != nil {
+				return core.AffinityPolicy{}, err
+			}
+		}
+	default:
+		return core.AffinityPolicy{}, fmt.Errorf("unknown affinity mode: %q", cfg.Mode)
+	}
+
+	return policy, nil
 }
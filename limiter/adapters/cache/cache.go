@@ -0,0 +1,286 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"testtask/limiter/core"
+	"time"
+)
+
+const (
+	// Токены списываются из локальной копии bucket, списанное записывается в хранилище раз в интервал.
+	// Несколько экземпляров лимитера за интервал могут вместе пропустить больше лимита
+	ModeBatch = "batch"
+	// У хранилища заранее выкупается блок токенов, запросы тратят его локально.
+	// Лимит не превышается, но невыкупленные токены пропадают, если клиент перестал присылать запросы
+	ModeLease = "lease"
+)
+
+// Локальный кэш token bucket перед любым core.RateLimiterDB. Кэшируется только ConsumeTokens,
+// остальные операции и алгоритмы идут в хранилище напрямую
+type Cache struct {
+	core.RateLimiterDB
+	log          *slog.Logger
+	mode         string
+	syncInterval time.Duration
+	leaseSize    int
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	mu sync.Mutex
+	// Последнее известное состояние клиента, в режиме batch с учетом локальных списаний
+	client core.Client
+	loaded bool
+	// Режим batch: списано локально и еще не записано в хранилище
+	pending     int
+	defaultRate float64
+	// Режим lease: выкупленные у хранилища и еще не потраченные токены
+	leased int
+	used   bool
+	// Режим lease: до этого момента в хранилище заведомо не хватает токенов, запросы отклоняются локально
+	blockedUntil time.Time
+	// Режим lease: прошла синхронизация, перед следующим решением состояние клиента перечитывается из хранилища
+	stale bool
+	// Bucket удален из кэша, запрос должен взять новый
+	removed bool
+}
+
+func New(log *slog.Logger, db core.RateLimiterDB, mode string, syncInterval time.Duration, leaseSize int) (*Cache, error) {
+	if mode != ModeBatch && mode != ModeLease {
+		return nil, fmt.Errorf("unknown cache mode: %q", mode)
+	}
+
+	return &Cache{
+		RateLimiterDB: db,
+		log:           log,
+		mode:          mode,
+		syncInterval:  syncInterval,
+		leaseSize:     max(leaseSize, 1),
+		buckets:       make(map[string]*bucket),
+	}, nil
+}
+
+// Возвращает заблокированный bucket клиента
+func (c *Cache) bucket(clientID string) *bucket {
+	for {
+		c.mu.Lock()
+		b, ok := c.buckets[clientID]
+		if !ok {
+			b = &bucket{}
+			c.buckets[clientID] = b
+		}
+		c.mu.Unlock()
+
+		b.mu.Lock()
+		if !b.removed {
+			return b
+		}
+		b.mu.Unlock()
+	}
+}
+
+// Клиент с загруженным bucket отдается из кэша, чтобы выбор алгоритма не требовал запроса к хранилищу
+func (c *Cache) GetClient(ctx context.Context, clientID string) (core.Client, error) {
+	c.mu.Lock()
+	b, ok := c.buckets[clientID]
+	c.mu.Unlock()
+
+	if ok {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if b.loaded && !b.removed {
+			if c.mode == ModeLease {
+				if err := c.refresh(ctx, b, clientID); err != nil {
+					return core.Client{}, err
+				}
+				return c.leaseState(b), nil
+			}
+			return b.client, nil
+		}
+	}
+	return c.RateLimiterDB.GetClient(ctx, clientID)
+}
+
+func (c *Cache) ConsumeTokens(ctx context.Context, clientID string, n int, now time.Time, defaultRate float64) (core.Client, bool, error) {
+	b := c.bucket(clientID)
+	defer b.mu.Unlock()
+
+	if c.mode == ModeLease {
+		return c.consumeLease(ctx, b, clientID, n, now, defaultRate)
+	}
+	return c.consumeBatch(ctx, b, clientID, n, now, defaultRate)
+}
+
+// Первый запрос клиента идет в хранилище и загружает bucket, следующие списывают токены локально
+func (c *Cache) consumeBatch(ctx context.Context, b *bucket, clientID string, n int, now time.Time, defaultRate float64) (core.Client, bool, error) {
+	if !b.loaded {
+		client, allowed, err := c.RateLimiterDB.ConsumeTokens(ctx, clientID, n, now, defaultRate)
+		if err != nil {
+			return core.Client{}, false, err
+		}
+		b.client = client
+		b.loaded = true
+		b.defaultRate = defaultRate
+		return client, allowed, nil
+	}
+
+	b.client.Refill(now, defaultRate)
+	b.defaultRate = defaultRate
+	if b.client.Tokens < n {
+		return b.client, false, nil
+	}
+	b.client.Tokens -= n
+	b.pending += n
+	return b.client, true, nil
+}
+
+// Запрос тратит выкупленные токены, а когда их не хватает, выкупает у хранилища новый блок.
+// Если на целый блок токенов нет, выкупается только нужное запросу. После отказа хранилища
+// запросы отклоняются локально, пока по скорости пополнения не накопятся недостающие токены
+func (c *Cache) consumeLease(ctx context.Context, b *bucket, clientID string, n int, now time.Time, defaultRate float64) (core.Client, bool, error) {
+	b.used = true
+	if err := c.refresh(ctx, b, clientID); err != nil {
+		return core.Client{}, false, err
+	}
+
+	if b.leased < n {
+		if now.Before(b.blockedUntil) {
+			return c.leaseState(b), false, nil
+		}
+
+		need := n - b.leased
+		block := max(need, c.leaseSize)
+
+		client, allowed, err := c.RateLimiterDB.ConsumeTokens(ctx, clientID, block, now, defaultRate)
+		if err == nil && !allowed && block > need && client.Tokens >= need {
+			block = need
+			client, allowed, err = c.RateLimiterDB.ConsumeTokens(ctx, clientID, block, now, defaultRate)
+		}
+		if err != nil {
+			return core.Client{}, false, err
+		}
+
+		b.client = client
+		b.loaded = true
+		if !allowed {
+			b.blockedUntil = blockedUntil(client, need, defaultRate)
+			return c.leaseState(b), false, nil
+		}
+		b.leased += block
+	}
+
+	b.leased -= n
+	return c.leaseState(b), true, nil
+}
+
+// Перечитывает клиента после синхронизации, чтобы изменения capacity, refill_rate и алгоритма через CRUD
+// доходили до bucket. Выкупленные токены сохраняются, но не больше новой capacity
+func (c *Cache) refresh(ctx context.Context, b *bucket, clientID string) error {
+	if !b.stale {
+		return nil
+	}
+
+	client, err := c.RateLimiterDB.GetClient(ctx, clientID)
+	if errors.Is(err, core.ErrClientNotFound) {
+		// Клиент удален, выкупленные токены пропадают
+		b.loaded = false
+		b.leased = 0
+		b.stale = false
+	}
+	if err != nil {
+		return err
+	}
+	b.client = client
+	b.leased = min(b.leased, client.Capacity)
+	b.blockedUntil = time.Time{}
+	b.stale = false
+	return nil
+}
+
+// Когда в хранилище накопится need токенов. Без пополнения - до сброса bucket при синхронизации
+func blockedUntil(client core.Client, need int, defaultRate float64) time.Time {
+	rate := client.Rate(defaultRate)
+	if rate <= 0 {
+		return time.Now().Add(24 * time.Hour)
+	}
+	return client.LastRefill.Add(core.Seconds(float64(need-client.Tokens) / rate))
+}
+
+// Выкупленные токены еще доступны клиенту, поэтому добавляются к остатку в хранилище
+func (c *Cache) leaseState(b *bucket) core.Client {
+	client := b.client
+	client.Tokens += b.leased
+	return client
+}
+
+// Раз в syncInterval синхронизирует кэш с хранилищем, пока не отменен ctx
+func (c *Cache) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(c.syncInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.Flush(ctx)
+			}
+		}
+	}()
+}
+
+// Режим batch: записывает локальные списания в хранилище и удаляет bucket из кэша,
+// следующий запрос загрузит актуальное состояние. Режим lease: удаляет bucket, к которым не было
+// запросов с прошлой синхронизации, их невыкупленные токены пропадают. Остальные bucket перечитают
+// клиента из хранилища при следующем обращении
+func (c *Cache) Flush(ctx context.Context) {
+	c.mu.Lock()
+	buckets := make(map[string]*bucket, len(c.buckets))
+	for clientID, b := range c.buckets {
+		buckets[clientID] = b
+	}
+	c.mu.Unlock()
+
+	for clientID, b := range buckets {
+		b.mu.Lock()
+		remove := true
+		switch c.mode {
+		case ModeBatch:
+			if b.pending > 0 {
+				c.sync(ctx, clientID, b)
+			}
+		case ModeLease:
+			remove = !b.used
+			b.used = false
+			b.stale = b.loaded
+		}
+
+		if remove {
+			b.removed = true
+			c.mu.Lock()
+			delete(c.buckets, clientID)
+			c.mu.Unlock()
+		}
+		b.mu.Unlock()
+	}
+}
+
+// Если другие экземпляры уже потратили токены и на все списания их не хватает, списывается сколько осталось
+func (c *Cache) sync(ctx context.Context, clientID string, b *bucket) {
+	now := time.Now()
+	client, allowed, err := c.RateLimiterDB.ConsumeTokens(ctx, clientID, b.pending, now, b.defaultRate)
+	if err == nil && !allowed && client.Tokens > 0 {
+		_, _, err = c.RateLimiterDB.ConsumeTokens(ctx, clientID, client.Tokens, now, b.defaultRate)
+	}
+	if err != nil {
+		c.log.Error("failed to sync cached tokens", "client_id", clientID, "pending", b.pending, "error", err)
+	}
+	b.pending = 0
+}
@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"testtask/limiter/adapters/memory"
+	"testtask/limiter/core"
+	"time"
+)
+
+// Изменения клиента через CRUD доходят до выкупленного bucket после синхронизации
+func TestLeaseRefresh(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	db, err := memory.New(log, 1, "")
+	if err != nil {
+		t.Fatalf("new storage: %v", err)
+	}
+	c, err := New(log, db, ModeLease, time.Second, 5)
+	if err != nil {
+		t.Fatalf("new cache: %v", err)
+	}
+
+	ctx := context.Background()
+	now := time.Now()
+	client := core.Client{ClientID: "client", Capacity: 10, Tokens: 10, LastRefill: now, Algorithm: core.AlgorithmTokenBucket, WindowStart: now, TAT: now}
+	if err := db.CreateClient(ctx, client); err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+
+	// Первый запрос выкупает блок из 5 токенов, в хранилище остается 5
+	if _, ok, err := c.ConsumeTokens(ctx, "client", 1, now, 0); err != nil || !ok {
+		t.Fatalf("first request: allowed %v, error %v", ok, err)
+	}
+
+	if err := db.UpdateClientCapacity(ctx, "client", 2); err != nil {
+		t.Fatalf("update capacity: %v", err)
+	}
+	if err := db.UpdateClientAlgorithm(ctx, "client", core.AlgorithmGCRA); err != nil {
+		t.Fatalf("update algorithm: %v", err)
+	}
+	c.Flush(ctx)
+
+	got, err := c.GetClient(ctx, "client")
+	if err != nil {
+		t.Fatalf("get client: %v", err)
+	}
+	if got.Capacity != 2 || got.Algorithm != core.AlgorithmGCRA {
+		t.Fatalf("capacity %d, algorithm %q, want 2 and %q", got.Capacity, got.Algorithm, core.AlgorithmGCRA)
+	}
+
+	// Из 4 выкупленных токенов остается не больше новой capacity
+	for i := range 2 {
+		if _, ok, err := c.ConsumeTokens(ctx, "client", 1, now, 0); err != nil || !ok {
+			t.Fatalf("request %d after refresh: allowed %v, error %v", i, ok, err)
+		}
+	}
+	if leased := c.buckets["client"].leased; leased != 0 {
+		t.Fatalf("leased %d after refresh, want 0", leased)
+	}
+
+	if err := db.RemoveClient(ctx, "client"); err != nil {
+		t.Fatalf("remove client: %v", err)
+	}
+	c.Flush(ctx)
+	if _, _, err := c.ConsumeTokens(ctx, "client", 1, now, 0); err != core.ErrClientNotFound {
+		t.Fatalf("request for removed client: %v", err)
+	}
+}
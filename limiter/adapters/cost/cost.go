@@ -0,0 +1,107 @@
+package cost
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"testtask/limiter/config"
+	"testtask/limiter/core"
+)
+
+// Стоимость запроса по заголовку, шаблонам метода и пути или значению по умолчанию.
+// Шаблоны сопоставляются через http.ServeMux, поэтому из нескольких подходящих выбирается самый специфичный
+type Cost struct {
+	def    int
+	header string
+	mux    *http.ServeMux
+	costs  map[string]int
+	// Самая большая стоимость среди правил
+	max int
+}
+
+func New(cfg config.CostConfig) (*Cost, error) {
+	if cfg.Default <= 0 {
+		return nil, fmt.Errorf("default cost must be positive")
+	}
+
+	c := &Cost{
+		def:    cfg.Default,
+		header: cfg.Header,
+		mux:    http.NewServeMux(),
+		costs:  make(map[string]int, len(cfg.Rules)),
+	}
+	for _, rule := range cfg.Rules {
+		if rule.Cost <= 0 {
+			return nil, fmt.Errorf("cost of pattern %q must be positive", rule.Pattern)
+		}
+		if err := c.handle(rule.Pattern); err != nil {
+			return nil, err
+		}
+		c.costs[rule.Pattern] = rule.Cost
+		c.max = max(c.max, rule.Cost)
+	}
+	return c, nil
+}
+
+// ServeMux паникует на некорректных и конфликтующих шаблонах, превращаем панику в ошибку конфига
+func (c *Cost) handle(pattern string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("invalid cost pattern %q: %v", pattern, r)
+		}
+	}()
+	c.mux.Handle(pattern, http.NotFoundHandler())
+	return nil
+}
+
+func (c *Cost) Cost(r *http.Request) (int, error) {
+	if c.header != "" {
+		if value := strings.TrimSpace(r.Header.Get(c.header)); value != "" {
+			cost, err := strconv.Atoi(value)
+			if err != nil || cost <= 0 {
+				return 0, core.ErrInvalidCost
+			}
+			return cost, nil
+		}
+	}
+
+	if len(c.costs) > 0 {
+		_, pattern := c.mux.Handler(cleanRequest(r))
+		if pattern == "" {
+			return c.def, nil
+		}
+		if cost, ok := c.costs[pattern]; ok {
+			return cost, nil
+		}
+		// Вместо правила ServeMux вернул редирект, в зависимости от версии Go с путем вместо шаблона.
+		// Куда попадет такой запрос, заранее неизвестно, поэтому он стоит как самое дорогое правило
+		return c.max, nil
+	}
+	return c.def, nil
+}
+
+// Для неочищенного пути (//export/1, /export/../export/1) ServeMux возвращает редирект, а не правило,
+// хотя сервис за лимитером может обработать такой запрос как очищенный. Поэтому сопоставляем очищенный путь,
+// как это делает ServeMux: path.Clean с сохранением слеша в конце
+func cleanRequest(r *http.Request) *http.Request {
+	p := r.URL.Path
+	if p == "" {
+		p = "/"
+	}
+	cleaned := path.Clean("/" + p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	if cleaned == r.URL.Path {
+		return r
+	}
+
+	u := *r.URL
+	u.Path = cleaned
+	u.RawPath = ""
+	clone := *r
+	clone.URL = &u
+	return &clone
+}
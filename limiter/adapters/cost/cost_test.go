@@ -0,0 +1,114 @@
+package cost
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testtask/limiter/config"
+	"testtask/limiter/core"
+)
+
+func newCost(t *testing.T, cfg config.CostConfig) *Cost {
+	t.Helper()
+	c, err := New(cfg)
+	if err != nil {
+		t.Fatalf("new cost: %v", err)
+	}
+	return c
+}
+
+func TestRules(t *testing.T) {
+	c := newCost(t, config.CostConfig{
+		Default: 1,
+		Rules: []config.CostRule{
+			{Pattern: "/export/", Cost: 2},
+			{Pattern: "POST /export/{id}", Cost: 10},
+			{Pattern: "GET /export/{id}", Cost: 3},
+			{Pattern: "POST /export/{id}/full", Cost: 20},
+		},
+	})
+
+	tests := []struct {
+		method, target string
+		want           int
+	}{
+		// Самый специфичный шаблон выигрывает
+		{http.MethodPost, "/export/1", 10},
+		{http.MethodGet, "/export/1", 3},
+		{http.MethodPost, "/export/1/full", 20},
+		{http.MethodDelete, "/export/1", 2},
+		{http.MethodPost, "/export/1/other", 2},
+		{http.MethodGet, "/other", 1},
+		// Неочищенные пути сопоставляются как очищенные
+		{http.MethodPost, "//export/1", 10},
+		{http.MethodPost, "/export/../export/1", 10},
+		{http.MethodPost, "/export/./1", 10},
+		{http.MethodPost, "/other/../export/1/full", 20},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "http://limiter"+tt.target, nil)
+		// httptest разбирает target сам, неочищенный путь задаем явно
+		r.URL.Path = tt.target
+		got, err := c.Cost(r)
+		if err != nil {
+			t.Fatalf("%s %s: %v", tt.method, tt.target, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s %s: cost %d, want %d", tt.method, tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestHeader(t *testing.T) {
+	c := newCost(t, config.CostConfig{
+		Default: 1,
+		Header:  "X-Cost",
+		Rules:   []config.CostRule{{Pattern: "/export/{id}", Cost: 10}},
+	})
+
+	tests := []struct {
+		value string
+		want  int
+		err   error
+	}{
+		// Заголовок важнее правила
+		{"5", 5, nil},
+		{" 7 ", 7, nil},
+		// Пустой заголовок - стоимость по правилу
+		{"", 10, nil},
+		{"0", 0, core.ErrInvalidCost},
+		{"-1", 0, core.ErrInvalidCost},
+		{"1.5", 0, core.ErrInvalidCost},
+		{"abc", 0, core.ErrInvalidCost},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/export/1", nil)
+		if tt.value != "" {
+			r.Header.Set("X-Cost", tt.value)
+		}
+		got, err := c.Cost(r)
+		if !errors.Is(err, tt.err) || got != tt.want {
+			t.Errorf("header %q: cost %d, error %v, want %d and %v", tt.value, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	tests := map[string]config.CostConfig{
+		"zero default":      {Default: 0},
+		"zero rule cost":    {Default: 1, Rules: []config.CostRule{{Pattern: "/export", Cost: 0}}},
+		"invalid pattern":   {Default: 1, Rules: []config.CostRule{{Pattern: "export", Cost: 1}}},
+		"invalid wildcard":  {Default: 1, Rules: []config.CostRule{{Pattern: "/export/{id", Cost: 1}}},
+		"duplicate pattern": {Default: 1, Rules: []config.CostRule{{Pattern: "/export", Cost: 1}, {Pattern: "/export", Cost: 2}}},
+		"conflicting patterns": {Default: 1, Rules: []config.CostRule{
+			{Pattern: "/export/{id}", Cost: 1},
+			{Pattern: "/export/{name}", Cost: 2},
+		}},
+	}
+	for name, cfg := range tests {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
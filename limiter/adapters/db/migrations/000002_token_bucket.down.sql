@@ -0,0 +1,3 @@
+ALTER TABLE client
+    DROP COLUMN IF EXISTS refill_rate,
+    DROP COLUMN IF EXISTS last_refill;
\ No newline at end of file
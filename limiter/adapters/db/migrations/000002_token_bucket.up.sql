@@ -0,0 +1,3 @@
+ALTER TABLE client
+    ADD COLUMN IF NOT EXISTS refill_rate DOUBLE PRECISION NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS last_refill TIMESTAMPTZ NOT NULL DEFAULT NOW();
\ No newline at end of file
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS client_request;
+
+ALTER TABLE client
+    DROP COLUMN IF EXISTS algorithm,
+    DROP COLUMN IF EXISTS window_start,
+    DROP COLUMN IF EXISTS window_count,
+    DROP COLUMN IF EXISTS prev_count;
\ No newline at end of file
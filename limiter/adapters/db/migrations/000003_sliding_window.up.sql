@@ -0,0 +1,12 @@
+ALTER TABLE client
+    ADD COLUMN IF NOT EXISTS algorithm VARCHAR(64) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS window_start TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    ADD COLUMN IF NOT EXISTS window_count INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS prev_count INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS client_request (
+    client_id VARCHAR(255) NOT NULL REFERENCES client (client_id) ON DELETE CASCADE,
+    requested_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS client_request_client_id_requested_at_idx ON client_request (client_id, requested_at);
\ No newline at end of file
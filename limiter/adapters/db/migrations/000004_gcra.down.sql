@@ -0,0 +1,2 @@
+ALTER TABLE client
+    DROP COLUMN IF EXISTS tat;
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE client
+    ADD COLUMN IF NOT EXISTS tat TIMESTAMPTZ NOT NULL DEFAULT NOW();
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE client_request
+    DROP COLUMN IF EXISTS weight;
\ No newline at end of file
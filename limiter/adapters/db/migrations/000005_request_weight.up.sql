@@ -0,0 +1,2 @@
+ALTER TABLE client_request
+    ADD COLUMN IF NOT EXISTS weight INTEGER NOT NULL DEFAULT 1;
\ No newline at end of file
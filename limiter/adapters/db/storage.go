@@ -2,8 +2,11 @@ package db
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"log/slog"
 	"testtask/limiter/core"
+	"time"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/jmoiron/sqlx"
@@ -28,16 +31,25 @@ func New(log *slog.Logger, address string) (*DB, error) {
 	}, nil
 }
 
+// Закрывает пул соединений с бд, ожидая завершения текущих запросов
+func (db *DB) Close() error {
+	db.log.Debug("closing db connection pool")
+	return db.conn.Close()
+}
+
 func (db *DB) GetClient(ctx context.Context, clientID string) (core.Client, error) {
 	const query = `
-		SELECT client_id, capacity, tokens FROM client WHERE client_id = $1 FOR UPDATE;
+		SELECT client_id, capacity, tokens, refill_rate, last_refill, algorithm, window_start, window_count, prev_count, tat FROM client WHERE client_id = $1;
 	`
 
 	var client core.Client
 	err := db.conn.GetContext(ctx, &client, query, clientID)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return core.Client{}, core.ErrClientNotFound
+		}
 		db.log.Error("failed to get client", "client_id", clientID, "error", err)
-		return core.Client{}, core.ErrClientNotFound
+		return core.Client{}, err
 	}
 
 	return client, nil
@@ -45,7 +57,7 @@ func (db *DB) GetClient(ctx context.Context, clientID string) (core.Client, erro
 
 func (db *DB) GetAllClients(ctx context.Context) ([]core.Client, error) {
 	const query = `
-        SELECT client_id, capacity, tokens FROM client;
+        SELECT client_id, capacity, tokens, refill_rate, last_refill, algorithm, window_start, window_count, prev_count, tat FROM client;
     `
 
 	var clients []core.Client
@@ -58,16 +70,257 @@ func (db *DB) GetAllClients(ctx context.Context) ([]core.Client, error) {
 	return clients, nil
 }
 
-func (db *DB) UpdateClientToken(ctx context.Context, clientID string, token int) error {
+func (db *DB) CountClients(ctx context.Context) (int, error) {
+	const query = `
+		SELECT COUNT(*) FROM client;
+	`
+
+	var count int
+	err := db.conn.GetContext(ctx, &count, query)
+	if err != nil {
+		db.log.Error("failed to count clients", "error", err)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// Пополнение и списание выполняются одним запросом. Строка клиента блокируется в первом CTE,
+// поэтому конкурентные запросы выстраиваются в очередь и видят уже списанные токены.
+// Арифметика повторяет core.Client.Refill. Пополнение ограничивается capacity - tokens до приведения к INTEGER:
+// после долгого простоя elapsed * rate не помещается в int4, и каждый запрос клиента падал бы с integer out of range
+func (db *DB) ConsumeTokens(ctx context.Context, clientID string, n int, now time.Time, defaultRate float64) (core.Client, bool, error) {
+	const query = `
+		WITH cur AS (
+			SELECT client_id, capacity, tokens, last_refill,
+				CASE WHEN refill_rate > 0 THEN refill_rate ELSE $3::DOUBLE PRECISION END AS rate
+			FROM client
+			WHERE client_id = $1
+			FOR UPDATE
+		), refilled AS (
+			SELECT client_id, capacity, tokens, last_refill, rate,
+				CASE WHEN tokens < capacity AND rate > 0
+					THEN LEAST(GREATEST(FLOOR(EXTRACT(EPOCH FROM ($4::TIMESTAMPTZ - last_refill)) * rate), 0), capacity - tokens)::INTEGER
+					ELSE 0
+				END AS added
+			FROM cur
+		), bucket AS (
+			SELECT client_id,
+				LEAST(tokens + added, capacity) AS tokens,
+				CASE
+					WHEN tokens + added >= capacity THEN $4::TIMESTAMPTZ
+					WHEN added > 0 THEN last_refill + make_interval(secs => added / rate)
+					ELSE last_refill
+				END AS last_refill
+			FROM refilled
+		)
+		UPDATE client AS c
+		SET tokens = bucket.tokens - CASE WHEN bucket.tokens >= $2::INTEGER THEN $2::INTEGER ELSE 0 END,
+			last_refill = bucket.last_refill
+		FROM bucket
+		WHERE c.client_id = bucket.client_id
+		RETURNING c.client_id, c.capacity, c.tokens, c.refill_rate, c.last_refill, c.algorithm, c.window_start, c.window_count, c.prev_count, c.tat,
+			bucket.tokens >= $2::INTEGER AS allowed;
+	`
+
+	var row struct {
+		core.Client
+		Allowed bool `db:"allowed"`
+	}
+	err := db.conn.QueryRowxContext(ctx, query, clientID, n, defaultRate, now).StructScan(&row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return core.Client{}, false, core.ErrClientNotFound
+		}
+		db.log.Error("failed to consume tokens", "client_id", clientID, "error", err)
+		return core.Client{}, false, err
+	}
+
+	return row.Client, row.Allowed, nil
+}
+
+// Лог запросов хранится в отдельной таблице, запрос стоимостью n - одна строка с весом n.
+// Строка клиента блокируется до конца транзакции, поэтому конкурентные запросы одного клиента считают лог по очереди
+func (db *DB) ConsumeWindowLog(ctx context.Context, clientID string, n int, now time.Time, window time.Duration) (core.Client, core.WindowLog, bool, error) {
+	const (
+		lockQuery = `
+			SELECT client_id, capacity, tokens, refill_rate, last_refill, algorithm, window_start, window_count, prev_count, tat
+			FROM client WHERE client_id = $1 FOR UPDATE;
+		`
+		cleanQuery = `
+			DELETE FROM client_request WHERE client_id = $1 AND requested_at <= $2;
+		`
+		countQuery = `
+			SELECT COALESCE(SUM(weight), 0), COALESCE(MIN(requested_at), $2), COALESCE(MAX(requested_at), $2)
+			FROM client_request WHERE client_id = $1;
+		`
+		insertQuery = `
+			INSERT INTO client_request (client_id, requested_at, weight) VALUES ($1, $2, $3);
+		`
+	)
+
+	tx, err := db.conn.BeginTxx(ctx, nil)
+	if err != nil {
+		db.log.Error("failed to begin transaction", "client_id", clientID, "error", err)
+		return core.Client{}, core.WindowLog{}, false, err
+	}
+	defer tx.Rollback()
+
+	var client core.Client
+	if err := tx.GetContext(ctx, &client, lockQuery, clientID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return core.Client{}, core.WindowLog{}, false, core.ErrClientNotFound
+		}
+		db.log.Error("failed to get client", "client_id", clientID, "error", err)
+		return core.Client{}, core.WindowLog{}, false, err
+	}
+
+	if _, err := tx.ExecContext(ctx, cleanQuery, clientID, now.Add(-window)); err != nil {
+		db.log.Error("failed to clean request log", "client_id", clientID, "error", err)
+		return core.Client{}, core.WindowLog{}, false, err
+	}
+
+	var requests core.WindowLog
+	if err := tx.QueryRowxContext(ctx, countQuery, clientID, now).Scan(&requests.Count, &requests.Oldest, &requests.Newest); err != nil {
+		db.log.Error("failed to count requests", "client_id", clientID, "error", err)
+		return core.Client{}, core.WindowLog{}, false, err
+	}
+
+	allowed := requests.Count+n <= client.Capacity
+	if allowed {
+		if _, err := tx.ExecContext(ctx, insertQuery, clientID, now, n); err != nil {
+			db.log.Error("failed to log requests", "client_id", clientID, "error", err)
+			return core.Client{}, core.WindowLog{}, false, err
+		}
+		if requests.Count == 0 {
+			requests.Oldest = now
+		}
+		requests.Count += n
+		requests.Newest = now
+	}
+
+	if err := tx.Commit(); err != nil {
+		db.log.Error("failed to commit transaction", "client_id", clientID, "error", err)
+		return core.Client{}, core.WindowLog{}, false, err
+	}
+
+	return client, requests, allowed, nil
+}
+
+// Сдвиг окон и учет запросов выполняются одним запросом, арифметика повторяет core.Client.ShiftWindow и WindowAllows:
+// порог считается в микросекундах тем же выражением с DOUBLE PRECISION, что и в Go
+func (db *DB) ConsumeWindowCounter(ctx context.Context, clientID string, n int, now time.Time, window time.Duration) (core.Client, bool, error) {
+	const query = `
+		WITH cur AS (
+			SELECT client_id, capacity, window_start, window_count, prev_count,
+				EXTRACT(EPOCH FROM ($3::TIMESTAMPTZ - window_start)) AS elapsed
+			FROM client
+			WHERE client_id = $1
+			FOR UPDATE
+		), shifted AS (
+			SELECT client_id, capacity,
+				CASE
+					WHEN elapsed < $4::DOUBLE PRECISION THEN window_start
+					WHEN elapsed < 2 * $4::DOUBLE PRECISION THEN window_start + make_interval(secs => $4::DOUBLE PRECISION)
+					ELSE $3::TIMESTAMPTZ
+				END AS window_start,
+				CASE
+					WHEN elapsed < $4::DOUBLE PRECISION THEN window_count
+					ELSE 0
+				END AS window_count,
+				CASE
+					WHEN elapsed < $4::DOUBLE PRECISION THEN prev_count
+					WHEN elapsed < 2 * $4::DOUBLE PRECISION THEN window_count
+					ELSE 0
+				END AS prev_count
+			FROM cur
+		), free AS (
+			SELECT client_id, window_start, window_count, prev_count,
+				capacity - window_count - $2::INTEGER AS free
+			FROM shifted
+		), counter AS (
+			SELECT client_id, window_start, window_count, prev_count,
+				free >= 0 AND (prev_count <= free
+					OR ROUND(EXTRACT(EPOCH FROM ($3::TIMESTAMPTZ - window_start)) * 1e6) >= CEIL($5::DOUBLE PRECISION * (prev_count - free) / prev_count)) AS allowed
+			FROM free
+		)
+		UPDATE client AS c
+		SET window_start = counter.window_start,
+			window_count = counter.window_count + CASE WHEN counter.allowed THEN $2::INTEGER ELSE 0 END,
+			prev_count = counter.prev_count
+		FROM counter
+		WHERE c.client_id = counter.client_id
+		RETURNING c.client_id, c.capacity, c.tokens, c.refill_rate, c.last_refill, c.algorithm, c.window_start, c.window_count, c.prev_count, c.tat,
+			counter.allowed;
+	`
+
+	var row struct {
+		core.Client
+		Allowed bool `db:"allowed"`
+	}
+	err := db.conn.QueryRowxContext(ctx, query, clientID, n, now, window.Seconds(), window.Microseconds()).StructScan(&row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return core.Client{}, false, core.ErrClientNotFound
+		}
+		db.log.Error("failed to count window requests", "client_id", clientID, "error", err)
+		return core.Client{}, false, err
+	}
+
+	return row.Client, row.Allowed, nil
+}
+
+// TAT читается и сдвигается одним запросом, арифметика повторяет core.Client.ConsumeGCRA.
+// Интервал между запросами - целое число микросекунд, как в core.EmissionInterval, сравнение тоже идет
+// в целых микросекундах, чтобы запрос ровно через Retry-After проходил. NULL при нулевой скорости дает отказ
+func (db *DB) ConsumeGCRA(ctx context.Context, clientID string, n int, now time.Time, defaultRate float64) (core.Client, bool, error) {
+	const query = `
+		WITH cur AS (
+			SELECT client_id, capacity, GREATEST(tat, $3::TIMESTAMPTZ) AS tat,
+				CEIL(1e6 / NULLIF(CASE WHEN refill_rate > 0 THEN refill_rate ELSE $4::DOUBLE PRECISION END, 0))::BIGINT AS emission
+			FROM client
+			WHERE client_id = $1
+			FOR UPDATE
+		), cell AS (
+			SELECT client_id,
+				tat + $2::INTEGER * emission * INTERVAL '1 microsecond' AS tat,
+				COALESCE(ROUND(EXTRACT(EPOCH FROM (tat - $3::TIMESTAMPTZ)) * 1e6) + $2::INTEGER * emission <= capacity * emission, FALSE) AS allowed
+			FROM cur
+		)
+		UPDATE client AS c
+		SET tat = CASE WHEN cell.allowed THEN cell.tat ELSE c.tat END
+		FROM cell
+		WHERE c.client_id = cell.client_id
+		RETURNING c.client_id, c.capacity, c.tokens, c.refill_rate, c.last_refill, c.algorithm, c.window_start, c.window_count, c.prev_count, c.tat,
+			cell.allowed;
+	`
+
+	var row struct {
+		core.Client
+		Allowed bool `db:"allowed"`
+	}
+	err := db.conn.QueryRowxContext(ctx, query, clientID, n, now, defaultRate).StructScan(&row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return core.Client{}, false, core.ErrClientNotFound
+		}
+		db.log.Error("failed to consume gcra", "client_id", clientID, "error", err)
+		return core.Client{}, false, err
+	}
+
+	return row.Client, row.Allowed, nil
+}
+
+func (db *DB) UpdateClientCapacity(ctx context.Context, clientID string, capacity int) error {
 	const query = `
 		UPDATE client 
-		SET tokens = $1
+		SET capacity = $1
 		WHERE client_id = $2;
 	`
 
-	result, err := db.conn.ExecContext(ctx, query, token, clientID)
+	result, err := db.conn.ExecContext(ctx, query, capacity, clientID)
 	if err != nil {
-		db.log.Error("failed to update tokens", "client_id", clientID, "error", err)
+		db.log.Error("failed to update capacity", "client_id", clientID, "error", err)
 		return err
 	}
 
@@ -80,16 +333,38 @@ func (db *DB) UpdateClientToken(ctx context.Context, clientID string, token int)
 	return nil
 }
 
-func (db *DB) UpdateClientCapacity(ctx context.Context, clientID string, capacity int) error {
+func (db *DB) UpdateClientRefillRate(ctx context.Context, clientID string, rate float64) error {
 	const query = `
 		UPDATE client 
-		SET capacity = $1
+		SET refill_rate = $1
 		WHERE client_id = $2;
 	`
 
-	result, err := db.conn.ExecContext(ctx, query, capacity, clientID)
+	result, err := db.conn.ExecContext(ctx, query, rate, clientID)
 	if err != nil {
-		db.log.Error("failed to update capacity", "client_id", clientID, "error", err)
+		db.log.Error("failed to update refill rate", "client_id", clientID, "error", err)
+		return err
+	}
+
+	rowsChanged, _ := result.RowsAffected()
+	if rowsChanged == 0 {
+		db.log.Warn("client not found", "client_id", clientID)
+		return core.ErrClientNotFound
+	}
+
+	return nil
+}
+
+func (db *DB) UpdateClientAlgorithm(ctx context.Context, clientID string, algorithm string) error {
+	const query = `
+		UPDATE client 
+		SET algorithm = $1
+		WHERE client_id = $2;
+	`
+
+	result, err := db.conn.ExecContext(ctx, query, algorithm, clientID)
+	if err != nil {
+		db.log.Error("failed to update algorithm", "client_id", clientID, "error", err)
 		return err
 	}
 
@@ -104,8 +379,8 @@ func (db *DB) UpdateClientCapacity(ctx context.Context, clientID string, capacit
 
 func (db *DB) CreateClient(ctx context.Context, client core.Client) error {
 	const query = `
-		INSERT INTO client (client_id, capacity, tokens)
-		VALUES (:client_id, :capacity, :tokens)
+		INSERT INTO client (client_id, capacity, tokens, refill_rate, last_refill, algorithm, window_start, window_count, prev_count, tat)
+		VALUES (:client_id, :capacity, :tokens, :refill_rate, :last_refill, :algorithm, :window_start, :window_count, :prev_count, :tat)
 		ON CONFLICT (client_id) 
 		DO NOTHING;
 	`
@@ -140,26 +415,3 @@ func (db *DB) RemoveClient(ctx context.Context, clientID string) error {
 
 	return nil
 }
-
-func (db *DB) UpdateAllTokens(ctx context.Context) error {
-	// Оборачиваем операции в транзакцию для потокобезопасности
-	tx, err := db.conn.BeginTxx(ctx, nil)
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
-	const query = `
-		UPDATE client
-		SET tokens = capacity
-		WHERE tokens < capacity;
-	`
-
-	_, err = tx.ExecContext(ctx, query)
-	if err != nil {
-		db.log.Error("failed to update tokens", "error", err)
-		return err
-	}
-
-	db.log.Debug("tokens updated for all clients")
-	return tx.Commit()
-}
@@ -0,0 +1,97 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testtask/limiter/core"
+	"time"
+)
+
+// Тестам нужна запущенная бд, адрес берется из DB_ADDRESS
+func newDB(t *testing.T) *DB {
+	t.Helper()
+	address := os.Getenv("DB_ADDRESS")
+	if address == "" {
+		t.Skip("DB_ADDRESS is not set")
+	}
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	db, err := New(log, address)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+// Конкурентные списания не должны пропустить больше capacity запросов
+func TestConsumeTokensConcurrent(t *testing.T) {
+	db := newDB(t)
+
+	const capacity, workers = 10, 50
+	ctx := context.Background()
+	now := time.Now()
+	clientID := fmt.Sprintf("test-concurrent-%d", now.UnixNano())
+
+	// Без пополнения: refill_rate и скорость по умолчанию равны 0
+	client := core.Client{ClientID: clientID, Capacity: capacity, Tokens: capacity, LastRefill: now, WindowStart: now, TAT: now}
+	if err := db.CreateClient(ctx, client); err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+	defer db.RemoveClient(ctx, clientID)
+
+	var allowed atomic.Int64
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, ok, err := db.ConsumeTokens(ctx, clientID, 1, now, 0)
+			if err != nil {
+				t.Errorf("consume tokens: %v", err)
+				return
+			}
+			if ok {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := allowed.Load(); got != capacity {
+		t.Fatalf("allowed %d requests, want %d", got, capacity)
+	}
+}
+
+// После долгого простоя elapsed * rate не помещается в int4, пополнение все равно не больше capacity
+func TestConsumeTokensLongIdle(t *testing.T) {
+	db := newDB(t)
+
+	ctx := context.Background()
+	now := time.Now()
+	clientID := fmt.Sprintf("test-idle-%d", now.UnixNano())
+	lastRefill := now.Add(-300 * 24 * time.Hour)
+
+	client := core.Client{ClientID: clientID, Capacity: 10, Tokens: 0, RefillRate: 100, LastRefill: lastRefill, WindowStart: now, TAT: now}
+	if err := db.CreateClient(ctx, client); err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+	defer db.RemoveClient(ctx, clientID)
+
+	got, ok, err := db.ConsumeTokens(ctx, clientID, 1, now, 0)
+	if err != nil {
+		t.Fatalf("consume tokens: %v", err)
+	}
+	if !ok || got.Tokens != 9 || !got.LastRefill.Equal(now.Truncate(time.Microsecond)) {
+		t.Fatalf("allowed %v, tokens %d, last refill %v, want true, 9 and %v", ok, got.Tokens, got.LastRefill, now)
+	}
+}
@@ -0,0 +1,127 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"testtask/limiter/adapters/ratelimiter"
+	"testtask/limiter/core"
+	"time"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	ratelimitv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/common/ratelimit/v3"
+	rlsv3 "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
+	grpclib "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Ключ записи дескриптора, значение которой задает политику лимита
+const policyEntry = "policy"
+
+// Экранирует разделители в частях ключа клиента, чтобы разные дескрипторы не давали один ключ
+var keyEscaper = strings.NewReplacer(`\`, `\\`, "|", `\|`, "=", `\=`)
+
+// Реализация envoy.service.ratelimit.v3.RateLimitService поверх лимитера.
+// Каждый дескриптор - отдельный клиент с ключом "<domain>|<key>=<value>|...", символы \, | и = в частях ключа экранируются.
+// Политика берется из записи дескриптора policy, иначе из политики с именем domain, иначе лимит по умолчанию.
+// Лимиты из дескриптора (limit) игнорируются: лимиты клиентов задаются в хранилище
+type Server struct {
+	rlsv3.UnimplementedRateLimitServiceServer
+	log      *slog.Logger
+	policies *ratelimiter.Policies
+	db       core.RateLimiterDB
+}
+
+// Создает gRPC-сервер с зарегистрированным сервисом лимита
+func NewServer(log *slog.Logger, policies *ratelimiter.Policies, db core.RateLimiterDB) *grpclib.Server {
+	server := grpclib.NewServer()
+	rlsv3.RegisterRateLimitServiceServer(server, &Server{log: log, policies: policies, db: db})
+	return server
+}
+
+// Запрос превышает лимит, если лимит превышен хотя бы для одного дескриптора.
+// Дескриптор с неизвестной политикой получает код UNKNOWN и не влияет на решение
+func (s *Server) ShouldRateLimit(ctx context.Context, req *rlsv3.RateLimitRequest) (*rlsv3.RateLimitResponse, error) {
+	if req.GetDomain() == "" || len(req.GetDescriptors()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "domain and descriptors are required")
+	}
+
+	resp := &rlsv3.RateLimitResponse{
+		OverallCode: rlsv3.RateLimitResponse_OK,
+		Statuses:    make([]*rlsv3.RateLimitResponse_DescriptorStatus, 0, len(req.GetDescriptors())),
+	}
+	var retryAfter time.Duration
+	for _, descriptor := range req.GetDescriptors() {
+		policy, key := s.clientKey(req.GetDomain(), descriptor)
+		cost := hitsAddend(req, descriptor)
+
+		decision, err := s.policies.Allow(ctx, policy, key, cost, s.db)
+		if errors.Is(err, core.ErrUnknownPolicy) {
+			s.log.Warn("unknown policy in descriptor", "domain", req.GetDomain(), "policy", policy)
+			resp.Statuses = append(resp.Statuses, &rlsv3.RateLimitResponse_DescriptorStatus{Code: rlsv3.RateLimitResponse_UNKNOWN})
+			continue
+		}
+		if err != nil {
+			s.log.Error("failed to make decision", "domain", req.GetDomain(), "key", key, "error", err)
+			return nil, status.Error(codes.Internal, "failed to make decision")
+		}
+
+		code := rlsv3.RateLimitResponse_OK
+		if !decision.Allowed {
+			code = rlsv3.RateLimitResponse_OVER_LIMIT
+			resp.OverallCode = rlsv3.RateLimitResponse_OVER_LIMIT
+			retryAfter = max(retryAfter, decision.RetryAfter)
+		}
+		resp.Statuses = append(resp.Statuses, &rlsv3.RateLimitResponse_DescriptorStatus{
+			Code: code,
+			CurrentLimit: &rlsv3.RateLimitResponse_RateLimit{
+				Name:            policy,
+				RequestsPerUnit: uint32(decision.Limit),
+			},
+			LimitRemaining:     uint32(max(decision.Remaining, 0)),
+			DurationUntilReset: durationpb.New(decision.Reset),
+		})
+	}
+
+	if resp.OverallCode == rlsv3.RateLimitResponse_OVER_LIMIT {
+		resp.ResponseHeadersToAdd = []*corev3.HeaderValue{{
+			Key:   "Retry-After",
+			Value: strconv.Itoa(max(int(math.Ceil(retryAfter.Seconds())), 1)),
+		}}
+	}
+	return resp, nil
+}
+
+// Возвращает политику и ключ клиента для дескриптора
+func (s *Server) clientKey(domain string, descriptor *ratelimitv3.RateLimitDescriptor) (string, string) {
+	policy := ""
+	if s.policies.Has(domain) {
+		policy = domain
+	}
+
+	parts := []string{keyEscaper.Replace(domain)}
+	for _, entry := range descriptor.GetEntries() {
+		if entry.GetKey() == policyEntry {
+			policy = entry.GetValue()
+			continue
+		}
+		parts = append(parts, keyEscaper.Replace(entry.GetKey())+"="+keyEscaper.Replace(entry.GetValue()))
+	}
+	return policy, strings.Join(parts, "|")
+}
+
+// Стоимость дескриптора: hits_addend дескриптора, иначе запроса, по умолчанию 1
+func hitsAddend(req *rlsv3.RateLimitRequest, descriptor *ratelimitv3.RateLimitDescriptor) int {
+	if hits := descriptor.GetHitsAddend(); hits != nil && hits.GetValue() > 0 {
+		return int(min(hits.GetValue(), math.MaxInt32))
+	}
+	if req.GetHitsAddend() > 0 {
+		return int(req.GetHitsAddend())
+	}
+	return 1
+}
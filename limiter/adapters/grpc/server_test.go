@@ -0,0 +1,205 @@
+package grpc
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"slices"
+	"testing"
+	"testtask/limiter/adapters/memory"
+	"testtask/limiter/adapters/ratelimiter"
+	"testtask/limiter/config"
+	"testtask/limiter/core"
+	"time"
+
+	ratelimitv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/common/ratelimit/v3"
+	rlsv3 "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
+	grpclib "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// Поднимает сервис на bufconn с хранилищем в памяти. Лимит по умолчанию - 2 запроса в час,
+// политика api - 10 запросов, политика с именем домена limited - 3 запроса
+func newClient(t *testing.T) (rlsv3.RateLimitServiceClient, *memory.Storage) {
+	t.Helper()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	var cfg config.Config
+	cfg.RateLimit = config.RateLimit{Capacity: 2, UpdateInterval: time.Hour, Algorithm: core.AlgorithmTokenBucket, Window: time.Minute}
+	cfg.Policies = map[string]config.RateLimit{
+		"api":     {Capacity: 10},
+		"limited": {Capacity: 3},
+	}
+	policies, err := ratelimiter.NewPolicies(log, cfg, func(rl core.RateLimiter) core.RateLimiter { return rl })
+	if err != nil {
+		t.Fatalf("new policies: %v", err)
+	}
+	db, err := memory.New(log, 1, "")
+	if err != nil {
+		t.Fatalf("new storage: %v", err)
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	server := NewServer(log, policies, db)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpclib.NewClient("passthrough:///bufnet",
+		grpclib.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpclib.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return rlsv3.NewRateLimitServiceClient(conn), db
+}
+
+func descriptor(hits uint64, entries ...string) *ratelimitv3.RateLimitDescriptor {
+	d := &ratelimitv3.RateLimitDescriptor{}
+	for i := 0; i+1 < len(entries); i += 2 {
+		d.Entries = append(d.Entries, &ratelimitv3.RateLimitDescriptor_Entry{Key: entries[i], Value: entries[i+1]})
+	}
+	if hits > 0 {
+		d.HitsAddend = wrapperspb.UInt64(hits)
+	}
+	return d
+}
+
+func shouldRateLimit(t *testing.T, client rlsv3.RateLimitServiceClient, req *rlsv3.RateLimitRequest) *rlsv3.RateLimitResponse {
+	t.Helper()
+	resp, err := client.ShouldRateLimit(context.Background(), req)
+	if err != nil {
+		t.Fatalf("should rate limit: %v", err)
+	}
+	return resp
+}
+
+// Политика из записи дескриптора важнее политики домена, без них используется лимит по умолчанию
+func TestPolicy(t *testing.T) {
+	client, _ := newClient(t)
+
+	tests := []struct {
+		name   string
+		domain string
+		desc   *ratelimitv3.RateLimitDescriptor
+		policy string
+		limit  uint32
+	}{
+		{"descriptor entry", "limited", descriptor(0, "policy", "api", "user", "a"), "api", 10},
+		{"domain", "limited", descriptor(0, "user", "a"), "limited", 3},
+		{"default", "other", descriptor(0, "user", "a"), "", 2},
+	}
+	for _, tt := range tests {
+		resp := shouldRateLimit(t, client, &rlsv3.RateLimitRequest{Domain: tt.domain, Descriptors: []*ratelimitv3.RateLimitDescriptor{tt.desc}})
+		st := resp.GetStatuses()[0]
+		if st.GetCode() != rlsv3.RateLimitResponse_OK || st.GetCurrentLimit().GetName() != tt.policy || st.GetCurrentLimit().GetRequestsPerUnit() != tt.limit {
+			t.Errorf("%s: status %v, policy %q, limit %d, want OK, %q and %d",
+				tt.name, st.GetCode(), st.GetCurrentLimit().GetName(), st.GetCurrentLimit().GetRequestsPerUnit(), tt.policy, tt.limit)
+		}
+	}
+}
+
+// hits_addend дескриптора важнее hits_addend запроса, по умолчанию стоимость 1
+func TestHitsAddend(t *testing.T) {
+	client, _ := newClient(t)
+
+	tests := []struct {
+		name       string
+		reqHits    uint32
+		desc       *ratelimitv3.RateLimitDescriptor
+		wantRemain uint32
+	}{
+		{"descriptor", 5, descriptor(2, "policy", "api", "user", "a"), 8},
+		{"request", 5, descriptor(0, "policy", "api", "user", "b"), 5},
+		{"default", 0, descriptor(0, "policy", "api", "user", "c"), 9},
+	}
+	for _, tt := range tests {
+		resp := shouldRateLimit(t, client, &rlsv3.RateLimitRequest{Domain: "dom", HitsAddend: tt.reqHits, Descriptors: []*ratelimitv3.RateLimitDescriptor{tt.desc}})
+		if got := resp.GetStatuses()[0].GetLimitRemaining(); got != tt.wantRemain {
+			t.Errorf("%s: remaining %d, want %d", tt.name, got, tt.wantRemain)
+		}
+	}
+}
+
+// Дескриптор с неизвестной политикой получает UNKNOWN и не влияет на общий ответ
+func TestUnknownPolicy(t *testing.T) {
+	client, _ := newClient(t)
+
+	resp := shouldRateLimit(t, client, &rlsv3.RateLimitRequest{Domain: "dom", Descriptors: []*ratelimitv3.RateLimitDescriptor{
+		descriptor(0, "policy", "missing", "user", "a"),
+		descriptor(0, "user", "a"),
+	}})
+	if resp.GetOverallCode() != rlsv3.RateLimitResponse_OK {
+		t.Fatalf("overall code %v, want OK", resp.GetOverallCode())
+	}
+	if got := resp.GetStatuses()[0].GetCode(); got != rlsv3.RateLimitResponse_UNKNOWN {
+		t.Fatalf("unknown policy status %v, want UNKNOWN", got)
+	}
+	if got := resp.GetStatuses()[1].GetCode(); got != rlsv3.RateLimitResponse_OK {
+		t.Fatalf("default policy status %v, want OK", got)
+	}
+}
+
+func TestOverLimit(t *testing.T) {
+	client, _ := newClient(t)
+	req := &rlsv3.RateLimitRequest{Domain: "dom", Descriptors: []*ratelimitv3.RateLimitDescriptor{descriptor(0, "user", "a")}}
+
+	for range 2 {
+		if resp := shouldRateLimit(t, client, req); resp.GetOverallCode() != rlsv3.RateLimitResponse_OK {
+			t.Fatalf("overall code %v, want OK", resp.GetOverallCode())
+		}
+	}
+
+	resp := shouldRateLimit(t, client, req)
+	if resp.GetOverallCode() != rlsv3.RateLimitResponse_OVER_LIMIT || resp.GetStatuses()[0].GetCode() != rlsv3.RateLimitResponse_OVER_LIMIT {
+		t.Fatalf("overall code %v, status %v, want OVER_LIMIT", resp.GetOverallCode(), resp.GetStatuses()[0].GetCode())
+	}
+	headers := resp.GetResponseHeadersToAdd()
+	if len(headers) != 1 || headers[0].GetKey() != "Retry-After" || headers[0].GetValue() == "" || headers[0].GetValue() == "0" {
+		t.Fatalf("headers %v, want positive Retry-After", headers)
+	}
+}
+
+// Разделители в значениях экранируются, поэтому разные дескрипторы не попадают в один bucket
+func TestClientKeyEscaping(t *testing.T) {
+	client, db := newClient(t)
+
+	for _, desc := range []*ratelimitv3.RateLimitDescriptor{
+		descriptor(2, "a", "x|b=y"),
+		descriptor(2, "a", "x", "b", "y"),
+	} {
+		resp := shouldRateLimit(t, client, &rlsv3.RateLimitRequest{Domain: "dom", Descriptors: []*ratelimitv3.RateLimitDescriptor{desc}})
+		if resp.GetOverallCode() != rlsv3.RateLimitResponse_OK {
+			t.Fatalf("descriptor %v: overall code %v, want OK", desc.GetEntries(), resp.GetOverallCode())
+		}
+	}
+
+	clients, err := db.GetAllClients(context.Background())
+	if err != nil {
+		t.Fatalf("get clients: %v", err)
+	}
+	var ids []string
+	for _, c := range clients {
+		ids = append(ids, c.ClientID)
+	}
+	slices.Sort(ids)
+	want := []string{`default:dom|a=x\|b\=y`, `default:dom|a=x|b=y`}
+	if !slices.Equal(ids, want) {
+		t.Fatalf("client ids %q, want %q", ids, want)
+	}
+}
+
+func TestInvalidRequest(t *testing.T) {
+	client, _ := newClient(t)
+
+	_, err := client.ShouldRateLimit(context.Background(), &rlsv3.RateLimitRequest{Domain: "dom"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("error %v, want InvalidArgument", err)
+	}
+}
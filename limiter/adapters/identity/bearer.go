@@ -0,0 +1,87 @@
+package identity
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testtask/limiter/core"
+	"time"
+)
+
+// Клиент определяется по полю sub из JWT в заголовке Authorization: Bearer <token>.
+// Проверяется подпись HS256 и срок действия (exp, nbf): без проверки подписи клиент
+// мог бы менять sub, чтобы обойти лимит, или подставить чужой sub и израсходовать его лимит
+type Bearer struct {
+	secret []byte
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+}
+
+type jwtClaims struct {
+	Sub string   `json:"sub"`
+	Exp *float64 `json:"exp"`
+	Nbf *float64 `json:"nbf"`
+}
+
+// Проверяет exp и nbf, если они заданы. Время в JWT - секунды unix, возможно дробные
+func (c jwtClaims) valid(now time.Time) bool {
+	unix := float64(now.UnixNano()) / float64(time.Second)
+	if c.Exp != nil && unix >= *c.Exp {
+		return false
+	}
+	if c.Nbf != nil && unix < *c.Nbf {
+		return false
+	}
+	return true
+}
+
+func (b *Bearer) ClientID(r *http.Request) (string, error) {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", core.ErrNoClientID
+	}
+
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != 3 {
+		return "", core.ErrNoClientID
+	}
+
+	if !b.verify(parts) {
+		return "", core.ErrNoClientID
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil || claims.Sub == "" || !claims.valid(time.Now()) {
+		return "", core.ErrNoClientID
+	}
+	return claims.Sub, nil
+}
+
+func (b *Bearer) verify(parts []string) bool {
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil || header.Alg != "HS256" {
+		return false
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, b.secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	return hmac.Equal(signature, mac.Sum(nil))
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,88 @@
+package identity
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"testtask/limiter/config"
+	"testtask/limiter/core"
+	"time"
+)
+
+func sign(secret, header, claims string) string {
+	token := base64.RawURLEncoding.EncodeToString([]byte(header)) + "." + base64.RawURLEncoding.EncodeToString([]byte(claims))
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(token))
+	return token + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestBearer(t *testing.T) {
+	const secret = "secret"
+	hs256 := `{"alg":"HS256","typ":"JWT"}`
+	now := time.Now().Unix()
+	claims := func(extra string) string {
+		return `{"sub":"client"` + extra + `}`
+	}
+	valid := sign(secret, hs256, claims(""))
+
+	tests := []struct {
+		name  string
+		auth  string
+		want  string
+		valid bool
+	}{
+		{name: "valid", auth: "Bearer " + valid, want: "client", valid: true},
+		{name: "scheme is case insensitive", auth: "bearer " + valid, want: "client", valid: true},
+		{name: "exp in future", auth: "Bearer " + sign(secret, hs256, claims(`,"exp":`+strconv.FormatInt(now+60, 10))), want: "client", valid: true},
+		{name: "nbf in past", auth: "Bearer " + sign(secret, hs256, claims(`,"nbf":`+strconv.FormatInt(now-60, 10))), want: "client", valid: true},
+		{name: "expired", auth: "Bearer " + sign(secret, hs256, claims(`,"exp":`+strconv.FormatInt(now-1, 10)))},
+		{name: "not yet valid", auth: "Bearer " + sign(secret, hs256, claims(`,"nbf":`+strconv.FormatInt(now+60, 10)))},
+		{name: "wrong secret", auth: "Bearer " + sign("other", hs256, claims(""))},
+		// Подмена sub без пересчета подписи
+		{name: "tampered claims", auth: "Bearer " + valid[:strings.Index(valid, ".")] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"other"}`)) + valid[strings.LastIndex(valid, "."):]},
+		{name: "alg none", auth: "Bearer " + base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + base64.RawURLEncoding.EncodeToString([]byte(claims(""))) + "."},
+		{name: "other alg", auth: "Bearer " + sign(secret, `{"alg":"HS512"}`, claims(""))},
+		{name: "empty sub", auth: "Bearer " + sign(secret, hs256, `{"sub":""}`)},
+		{name: "malformed", auth: "Bearer abc.def"},
+		{name: "bad signature encoding", auth: "Bearer " + valid + "!"},
+		{name: "basic scheme", auth: "Basic " + valid},
+		{name: "no header"},
+	}
+
+	b := &Bearer{secret: []byte(secret)}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/test", nil)
+			if tt.auth != "" {
+				r.Header.Set("Authorization", tt.auth)
+			}
+			got, err := b.ClientID(r)
+			if !tt.valid {
+				if !errors.Is(err, core.ErrNoClientID) {
+					t.Fatalf("client id %q, error %v, want %v", got, err, core.ErrNoClientID)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("client id %q, error %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+// Bearer без секрета не создается, в том числе в составе composite
+func TestBearerRequiresSecret(t *testing.T) {
+	for _, cfg := range []config.IdentityConfig{
+		{Type: "bearer"},
+		{Type: "composite", Composite: []string{"ip", "bearer"}},
+	} {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("%+v: expected error without jwt_secret", cfg)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package identity
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+	"testtask/limiter/config"
+	"testtask/limiter/core"
+)
+
+// Создает извлекатель идентификатора клиента по настройке type: ip, header, bearer или composite
+func New(cfg config.IdentityConfig) (core.ClientIdentifier, error) {
+	if cfg.Type != "composite" {
+		return newSingle(cfg.Type, cfg)
+	}
+
+	if len(cfg.Composite) == 0 {
+		return nil, fmt.Errorf("composite identity requires at least one part")
+	}
+	parts := make([]core.ClientIdentifier, 0, len(cfg.Composite))
+	for _, t := range cfg.Composite {
+		part, err := newSingle(strings.TrimSpace(t), cfg)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, part)
+	}
+	return &Composite{parts: parts}, nil
+}
+
+func newSingle(kind string, cfg config.IdentityConfig) (core.ClientIdentifier, error) {
+	switch kind {
+	case "ip":
+		return NewRemoteIP(cfg.TrustedProxies, cfg.ForwardedHeader)
+	case "header":
+		if cfg.Header == "" {
+			return nil, fmt.Errorf("header identity requires header name")
+		}
+		return &Header{name: cfg.Header}, nil
+	case "bearer":
+		if cfg.JWTSecret == "" {
+			return nil, fmt.Errorf("bearer identity requires jwt_secret")
+		}
+		return &Bearer{secret: []byte(cfg.JWTSecret)}, nil
+	default:
+		return nil, fmt.Errorf("unknown identity type: %q", kind)
+	}
+}
+
+// Клиент определяется по значению заголовка, например API-ключа
+type Header struct {
+	name string
+}
+
+func (h *Header) ClientID(r *http.Request) (string, error) {
+	value := strings.TrimSpace(r.Header.Get(h.name))
+	if value == "" {
+		return "", core.ErrNoClientID
+	}
+	return value, nil
+}
+
+// Составной ключ из нескольких идентификаторов, например ip и API-ключа
+type Composite struct {
+	parts []core.ClientIdentifier
+}
+
+func (c *Composite) ClientID(r *http.Request) (string, error) {
+	ids := make([]string, 0, len(c.parts))
+	for _, part := range c.parts {
+		id, err := part.ClientID(r)
+		if err != nil {
+			return "", err
+		}
+		ids = append(ids, id)
+	}
+	return strings.Join(ids, "|"), nil
+}
+
+// Разбирает список подсетей доверенных прокси, одиночный адрес считается подсетью из одного адреса
+func parsePrefixes(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if !strings.Contains(v, "/") {
+			addr, err := netip.ParseAddr(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", v, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", v, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
@@ -0,0 +1,110 @@
+package identity
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"testtask/limiter/core"
+)
+
+// Клиент определяется по ip. Если запрос пришел от доверенного прокси (например, от балансировщика),
+// адрес клиента берется из заголовка, который пишет этот прокси (X-Forwarded-For или Forwarded):
+// цепочка просматривается справа налево, и клиентом считается первый адрес, который не принадлежит доверенным прокси.
+// Другой заголовок не читается: прокси передает его от клиента без изменений, и клиент мог бы подставить любой адрес
+type RemoteIP struct {
+	trusted []netip.Prefix
+	header  string
+}
+
+func NewRemoteIP(trustedProxies []string, header string) (*RemoteIP, error) {
+	trusted, err := parsePrefixes(trustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	if header == "" {
+		header = "X-Forwarded-For"
+	}
+	return &RemoteIP{trusted: trusted, header: http.CanonicalHeaderKey(header)}, nil
+}
+
+func (ri *RemoteIP) ClientID(r *http.Request) (string, error) {
+	remote, ok := parseAddr(r.RemoteAddr)
+	if !ok {
+		return "", core.ErrNoClientID
+	}
+	if !ri.isTrusted(remote) {
+		return remote.String(), nil
+	}
+
+	var chain []string
+	if ri.header == "Forwarded" {
+		chain = forwardedFor(r.Header.Values(ri.header))
+	} else {
+		chain = xForwardedFor(r.Header.Values(ri.header))
+	}
+
+	client := remote
+	for i := len(chain) - 1; i >= 0; i-- {
+		addr, ok := parseAddr(chain[i])
+		if !ok {
+			// Подделанное или непонятное значение, дальше по цепочке доверять нельзя
+			break
+		}
+		client = addr
+		if !ri.isTrusted(addr) {
+			break
+		}
+	}
+	return client.String(), nil
+}
+
+func (ri *RemoteIP) isTrusted(addr netip.Addr) bool {
+	for _, prefix := range ri.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Разбирает адрес с портом или без, в том числе IPv6 в квадратных скобках
+func parseAddr(value string) (netip.Addr, bool) {
+	value = strings.TrimSpace(value)
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap().WithZone(""), true
+}
+
+// Значения for из заголовков Forwarded (RFC 7239), например: for=192.0.2.60;proto=http, for="[2001:db8::17]:4711"
+func forwardedFor(headers []string) []string {
+	var chain []string
+	for _, header := range headers {
+		for _, element := range strings.Split(header, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				key, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+				if found && strings.EqualFold(key, "for") {
+					chain = append(chain, strings.Trim(value, `"`))
+				}
+			}
+		}
+	}
+	return chain
+}
+
+func xForwardedFor(headers []string) []string {
+	var chain []string
+	for _, header := range headers {
+		for _, addr := range strings.Split(header, ",") {
+			chain = append(chain, strings.TrimSpace(addr))
+		}
+	}
+	return chain
+}
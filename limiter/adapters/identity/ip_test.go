@@ -0,0 +1,76 @@
+package identity
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"testtask/limiter/core"
+)
+
+func TestRemoteIP(t *testing.T) {
+	tests := []struct {
+		name      string
+		header    string
+		remote    string
+		forwarded string
+		xff       []string
+		want      string
+	}{
+		{name: "direct", remote: "203.0.113.7:5000", want: "203.0.113.7"},
+		{name: "untrusted remote ignores headers", remote: "203.0.113.7:5000", xff: []string{"198.51.100.1"}, want: "203.0.113.7"},
+		{name: "trusted proxy", remote: "10.0.0.1:5000", xff: []string{"198.51.100.1"}, want: "198.51.100.1"},
+		// Прокси дописывает адрес клиента в конец, подделанное начало цепочки не учитывается
+		{name: "spoofed chain", remote: "10.0.0.1:5000", xff: []string{"1.1.1.1, 198.51.100.1"}, want: "198.51.100.1"},
+		{name: "spoofed chain in separate header", remote: "10.0.0.1:5000", xff: []string{"1.1.1.1", "198.51.100.1"}, want: "198.51.100.1"},
+		{name: "chain of trusted proxies", remote: "10.0.0.1:5000", xff: []string{"1.1.1.1, 198.51.100.1, 10.0.0.2"}, want: "198.51.100.1"},
+		{name: "garbage stops chain", remote: "10.0.0.1:5000", xff: []string{"198.51.100.1, garbage, 10.0.0.2"}, want: "10.0.0.2"},
+		{name: "ipv6 with port", remote: "10.0.0.1:5000", xff: []string{"[2001:db8::17]:4711"}, want: "2001:db8::17"},
+		{name: "no header from trusted proxy", remote: "10.0.0.1:5000", want: "10.0.0.1"},
+		// Балансировщик передает Forwarded от клиента без изменений, при X-Forwarded-For он не читается
+		{name: "spoofed forwarded", remote: "10.0.0.1:5000", forwarded: "for=1.1.1.1", xff: []string{"198.51.100.1"}, want: "198.51.100.1"},
+		{name: "forwarded only", remote: "10.0.0.1:5000", forwarded: "for=1.1.1.1", want: "10.0.0.1"},
+		{name: "forwarded header", header: "Forwarded", remote: "10.0.0.1:5000", forwarded: `for=1.1.1.1, for="[2001:db8::17]:4711";proto=http`, xff: []string{"198.51.100.1"}, want: "2001:db8::17"},
+		{name: "forwarded header spoofed chain", header: "forwarded", remote: "10.0.0.1:5000", forwarded: "for=1.1.1.1, for=198.51.100.1, for=10.0.0.2", want: "198.51.100.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ri, err := NewRemoteIP([]string{"10.0.0.0/8"}, tt.header)
+			if err != nil {
+				t.Fatalf("new remote ip: %v", err)
+			}
+			r := httptest.NewRequest("GET", "/test", nil)
+			r.RemoteAddr = tt.remote
+			if tt.forwarded != "" {
+				r.Header.Set("Forwarded", tt.forwarded)
+			}
+			for _, value := range tt.xff {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+
+			got, err := ri.ClientID(r)
+			if err != nil {
+				t.Fatalf("client id: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("client id %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemoteIPInvalid(t *testing.T) {
+	if _, err := NewRemoteIP([]string{"10.0.0.0/33"}, ""); err == nil {
+		t.Fatal("expected error for invalid trusted proxy")
+	}
+
+	ri, err := NewRemoteIP(nil, "")
+	if err != nil {
+		t.Fatalf("new remote ip: %v", err)
+	}
+	r := httptest.NewRequest("GET", "/test", nil)
+	r.RemoteAddr = "not an address"
+	if _, err := ri.ClientID(r); !errors.Is(err, core.ErrNoClientID) {
+		t.Fatalf("client id error %v, want %v", err, core.ErrNoClientID)
+	}
+}
@@ -0,0 +1,109 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testtask/limiter/core"
+	"time"
+)
+
+type snapshotEntry struct {
+	Client   core.Client
+	Requests []time.Time `json:",omitempty"`
+}
+
+// Периодически сохраняет снимок в файл, пока не отменен ctx. Без файла ничего не делает
+func (s *Storage) StartSnapshots(ctx context.Context, interval time.Duration) {
+	if s.path == "" || interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.Snapshot(); err != nil {
+					s.log.Error("failed to save snapshot", "path", s.path, "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// Сохраняет всех клиентов в файл. Снимок пишется во временный файл и переименовывается,
+// чтобы при падении во время записи остался предыдущий снимок
+func (s *Storage) Snapshot() error {
+	if s.path == "" {
+		return nil
+	}
+
+	var entries []snapshotEntry
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		for _, e := range sh.clients {
+			entries = append(entries, snapshotEntry{Client: e.client, Requests: append([]time.Time(nil), e.requests...)})
+		}
+		sh.mu.Unlock()
+	}
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return err
+	}
+
+	s.log.Debug("snapshot saved", "path", s.path, "clients", len(entries))
+	return nil
+}
+
+// Сохраняет последний снимок при остановке
+func (s *Storage) Close() error {
+	return s.Snapshot()
+}
+
+func (s *Storage) load() error {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var entries []snapshotEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+	// Время последнего решения в снимок не входит, отсчет простоя начинается с загрузки
+	now := time.Now()
+	for _, e := range entries {
+		s.shard(e.Client.ClientID).clients[e.Client.ClientID] = &entry{client: e.Client, requests: e.Requests, lastSeen: now}
+	}
+
+	s.log.Info("snapshot loaded", "path", s.path, "clients", len(entries))
+	return nil
+}
@@ -0,0 +1,266 @@
+package memory
+
+import (
+	"context"
+	"hash/fnv"
+	"log/slog"
+	"slices"
+	"sort"
+	"sync"
+	"testtask/limiter/core"
+	"time"
+)
+
+// Хранилище клиентов в памяти процесса. Клиенты разложены по шардам по хешу client_id,
+// у каждого шарда свой мьютекс, поэтому запросы разных клиентов почти не ждут друг друга.
+// Состояние теряется при перезапуске, если не задан файл для снимков
+type Storage struct {
+	log    *slog.Logger
+	shards []*shard
+	path   string
+}
+
+type shard struct {
+	mu      sync.Mutex
+	clients map[string]*entry
+}
+
+// Клиент и, для sliding window log, время его запросов по возрастанию.
+// lastSeen - время последнего решения, по нему удаляются неактивные клиенты
+type entry struct {
+	client   core.Client
+	requests []time.Time
+	lastSeen time.Time
+}
+
+// Создает хранилище с заданным числом шардов. Если задан path, загружает последний снимок из файла
+func New(log *slog.Logger, shards int, path string) (*Storage, error) {
+	s := &Storage{
+		log:    log,
+		shards: make([]*shard, max(shards, 1)),
+		path:   path,
+	}
+	for i := range s.shards {
+		s.shards[i] = &shard{clients: make(map[string]*entry)}
+	}
+
+	if path != "" {
+		if err := s.load(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *Storage) shard(clientID string) *shard {
+	h := fnv.New32a()
+	h.Write([]byte(clientID))
+	return s.shards[h.Sum32()%uint32(len(s.shards))]
+}
+
+// Выполняет fn над клиентом под блокировкой его шарда, ErrClientNotFound если клиента нет
+func (s *Storage) update(clientID string, fn func(*entry)) error {
+	sh := s.shard(clientID)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	e, ok := sh.clients[clientID]
+	if !ok {
+		return core.ErrClientNotFound
+	}
+	fn(e)
+	return nil
+}
+
+func (s *Storage) GetClient(ctx context.Context, clientID string) (core.Client, error) {
+	var client core.Client
+	err := s.update(clientID, func(e *entry) {
+		client = e.client
+	})
+	return client, err
+}
+
+func (s *Storage) GetAllClients(ctx context.Context) ([]core.Client, error) {
+	var clients []core.Client
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		for _, e := range sh.clients {
+			clients = append(clients, e.client)
+		}
+		sh.mu.Unlock()
+	}
+	return clients, nil
+}
+
+func (s *Storage) CountClients(ctx context.Context) (int, error) {
+	count := 0
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		count += len(sh.clients)
+		sh.mu.Unlock()
+	}
+	return count, nil
+}
+
+// Как и в postgres, существующий клиент не перезаписывается
+func (s *Storage) CreateClient(ctx context.Context, client core.Client) error {
+	sh := s.shard(client.ClientID)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if _, ok := sh.clients[client.ClientID]; !ok {
+		sh.clients[client.ClientID] = &entry{client: client, lastSeen: time.Now()}
+	}
+	return nil
+}
+
+func (s *Storage) RemoveClient(ctx context.Context, clientID string) error {
+	sh := s.shard(clientID)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if _, ok := sh.clients[clientID]; !ok {
+		return core.ErrClientNotFound
+	}
+	delete(sh.clients, clientID)
+	return nil
+}
+
+func (s *Storage) UpdateClientCapacity(ctx context.Context, clientID string, capacity int) error {
+	return s.update(clientID, func(e *entry) {
+		e.client.Capacity = capacity
+	})
+}
+
+func (s *Storage) UpdateClientRefillRate(ctx context.Context, clientID string, rate float64) error {
+	return s.update(clientID, func(e *entry) {
+		e.client.RefillRate = rate
+	})
+}
+
+func (s *Storage) UpdateClientAlgorithm(ctx context.Context, clientID string, algorithm string) error {
+	return s.update(clientID, func(e *entry) {
+		e.client.Algorithm = algorithm
+	})
+}
+
+func (s *Storage) ConsumeTokens(ctx context.Context, clientID string, n int, now time.Time, defaultRate float64) (core.Client, bool, error) {
+	var (
+		client  core.Client
+		allowed bool
+	)
+	err := s.update(clientID, func(e *entry) {
+		e.lastSeen = now
+		e.client.Refill(now, defaultRate)
+		if e.client.Tokens >= n {
+			e.client.Tokens -= n
+			allowed = true
+		}
+		client = e.client
+	})
+	return client, allowed, err
+}
+
+func (s *Storage) ConsumeWindowLog(ctx context.Context, clientID string, n int, now time.Time, window time.Duration) (core.Client, core.WindowLog, bool, error) {
+	var (
+		client   core.Client
+		requests core.WindowLog
+		allowed  bool
+	)
+	err := s.update(clientID, func(e *entry) {
+		e.lastSeen = now
+		// Записи отсортированы по времени, поэтому устаревшие - это префикс лога
+		border := now.Add(-window)
+		expired := sort.Search(len(e.requests), func(i int) bool {
+			return e.requests[i].After(border)
+		})
+		e.requests = e.requests[expired:]
+
+		allowed = len(e.requests)+n <= e.client.Capacity
+		if allowed {
+			// Конкурентный запрос с более ранним now мог взять блокировку позже, вставляем с сохранением порядка
+			i := sort.Search(len(e.requests), func(i int) bool {
+				return e.requests[i].After(now)
+			})
+			e.requests = slices.Insert(e.requests, i, slices.Repeat([]time.Time{now}, n)...)
+		}
+
+		requests = core.WindowLog{Count: len(e.requests), Oldest: now, Newest: now}
+		if len(e.requests) > 0 {
+			requests.Oldest = e.requests[0]
+			requests.Newest = e.requests[len(e.requests)-1]
+		}
+		client = e.client
+	})
+	return client, requests, allowed, err
+}
+
+func (s *Storage) ConsumeWindowCounter(ctx context.Context, clientID string, n int, now time.Time, window time.Duration) (core.Client, bool, error) {
+	var (
+		client  core.Client
+		allowed bool
+	)
+	err := s.update(clientID, func(e *entry) {
+		e.lastSeen = now
+		e.client.ShiftWindow(now, window)
+		allowed = e.client.WindowAllows(n, now, window)
+		if allowed {
+			e.client.WindowCount += n
+		}
+		client = e.client
+	})
+	return client, allowed, err
+}
+
+func (s *Storage) ConsumeGCRA(ctx context.Context, clientID string, n int, now time.Time, defaultRate float64) (core.Client, bool, error) {
+	var (
+		client  core.Client
+		allowed bool
+	)
+	err := s.update(clientID, func(e *entry) {
+		e.lastSeen = now
+		allowed = e.client.ConsumeGCRA(n, now, defaultRate)
+		client = e.client
+	})
+	return client, allowed, err
+}
+
+// Периодически удаляет клиентов без решений дольше idleTTL, пока не отменен ctx, 0 - хранить бессрочно.
+// Без этого хранилище растет вместе с числом когда-либо виденных клиентов, например адресов при identity ip
+func (s *Storage) StartEviction(ctx context.Context, idleTTL time.Duration) {
+	if idleTTL <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(min(idleTTL, time.Minute))
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if evicted := s.evict(time.Now().Add(-idleTTL)); evicted > 0 {
+					s.log.Debug("evicted idle clients", "count", evicted)
+				}
+			}
+		}
+	}()
+}
+
+// Удаляет клиентов, последнее решение для которых было не позже border
+func (s *Storage) evict(border time.Time) int {
+	evicted := 0
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		for id, e := range sh.clients {
+			if !e.lastSeen.After(border) {
+				delete(sh.clients, id)
+				evicted++
+			}
+		}
+		sh.mu.Unlock()
+	}
+	return evicted
+}
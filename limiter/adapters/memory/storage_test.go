@@ -0,0 +1,124 @@
+package memory
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testtask/limiter/core"
+	"time"
+)
+
+// Конкурентные списания не должны пропустить больше capacity запросов
+func TestConsumeTokensConcurrent(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s, err := New(log, 4, "")
+	if err != nil {
+		t.Fatalf("new storage: %v", err)
+	}
+
+	const capacity, workers = 10, 50
+	ctx := context.Background()
+	now := time.Now()
+
+	// Без пополнения: refill_rate и скорость по умолчанию равны 0
+	client := core.Client{ClientID: "client", Capacity: capacity, Tokens: capacity, LastRefill: now, WindowStart: now, TAT: now}
+	if err := s.CreateClient(ctx, client); err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+
+	var allowed atomic.Int64
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, ok, err := s.ConsumeTokens(ctx, "client", 1, now, 0)
+			if err != nil {
+				t.Errorf("consume tokens: %v", err)
+				return
+			}
+			if ok {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := allowed.Load(); got != capacity {
+		t.Fatalf("allowed %d requests, want %d", got, capacity)
+	}
+}
+
+// Запись с более ранним временем, пришедшая позже, не ломает порядок лога и границы окна
+func TestConsumeWindowLogOrder(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s, err := New(log, 1, "")
+	if err != nil {
+		t.Fatalf("new storage: %v", err)
+	}
+
+	ctx := context.Background()
+	start := time.Now()
+	if err := s.CreateClient(ctx, core.Client{ClientID: "client", Capacity: 5}); err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+
+	for _, tc := range []struct {
+		offset  time.Duration
+		n       int
+		allowed bool
+		count   int
+	}{
+		{offset: 2 * time.Second, n: 2, allowed: true, count: 2},
+		{offset: time.Second, n: 1, allowed: true, count: 3},
+		{offset: 3 * time.Second, n: 3, allowed: false, count: 3},
+		// Через окно после первых запросов запрос с offset 1s выходит из окна, остаются два с offset 2s
+		{offset: 11500 * time.Millisecond, n: 3, allowed: true, count: 5},
+	} {
+		_, requests, allowed, err := s.ConsumeWindowLog(ctx, "client", tc.n, start.Add(tc.offset), 10*time.Second)
+		if err != nil {
+			t.Fatalf("consume window log: %v", err)
+		}
+		if allowed != tc.allowed || requests.Count != tc.count {
+			t.Fatalf("offset %s: allowed %v count %d, want %v %d", tc.offset, allowed, requests.Count, tc.allowed, tc.count)
+		}
+	}
+
+	_, requests, _, _ := s.ConsumeWindowLog(ctx, "client", 1, start.Add(11900*time.Millisecond), 10*time.Second)
+	if !requests.Oldest.Equal(start.Add(2*time.Second)) || !requests.Newest.Equal(start.Add(11500*time.Millisecond)) {
+		t.Fatalf("oldest %s newest %s, want 2s and 11.5s", requests.Oldest.Sub(start), requests.Newest.Sub(start))
+	}
+}
+
+// Удаляются только клиенты без решений после границы
+func TestEvict(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s, err := New(log, 2, "")
+	if err != nil {
+		t.Fatalf("new storage: %v", err)
+	}
+
+	ctx := context.Background()
+	now := time.Now()
+	for _, id := range []string{"idle", "active"} {
+		if err := s.CreateClient(ctx, core.Client{ClientID: id, Capacity: 1, Tokens: 1, LastRefill: now}); err != nil {
+			t.Fatalf("create client: %v", err)
+		}
+	}
+	if _, _, err := s.ConsumeTokens(ctx, "active", 1, now.Add(time.Hour), 0); err != nil {
+		t.Fatalf("consume tokens: %v", err)
+	}
+
+	if evicted := s.evict(now.Add(time.Minute)); evicted != 1 {
+		t.Fatalf("evicted %d clients, want 1", evicted)
+	}
+	if _, err := s.GetClient(ctx, "idle"); err != core.ErrClientNotFound {
+		t.Fatalf("idle client: got %v, want ErrClientNotFound", err)
+	}
+	if _, err := s.GetClient(ctx, "active"); err != nil {
+		t.Fatalf("active client: %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"context"
+	"testtask/limiter/core"
+	"time"
+)
+
+// Лимитер, который считает решения и общее время AllowClientRequest
+type instrumentedLimiter struct {
+	core.RateLimiter
+	metrics *Metrics
+}
+
+func (m *Metrics) InstrumentLimiter(rl core.RateLimiter) core.RateLimiter {
+	return &instrumentedLimiter{RateLimiter: rl, metrics: m}
+}
+
+func (l *instrumentedLimiter) AllowClientRequest(ctx context.Context, clientID string, cost int, db core.RateLimiterDB) (core.Decision, error) {
+	start := time.Now()
+	decision, err := l.RateLimiter.AllowClientRequest(ctx, clientID, cost, db)
+	l.metrics.observeDecision(clientID, decision.Allowed, err, time.Since(start))
+	return decision, err
+}
+
+// Хранилище, которое замеряет время каждой операции лимитера
+type instrumentedDB struct {
+	db      core.RateLimiterDB
+	metrics *Metrics
+}
+
+func (m *Metrics) InstrumentDB(db core.RateLimiterDB) core.RateLimiterDB {
+	return &instrumentedDB{db: db, metrics: m}
+}
+
+func (i *instrumentedDB) GetClient(ctx context.Context, clientID string) (core.Client, error) {
+	defer i.metrics.observeDB("get_client", time.Now())
+	return i.db.GetClient(ctx, clientID)
+}
+
+func (i *instrumentedDB) CreateClient(ctx context.Context, client core.Client) error {
+	defer i.metrics.observeDB("create_client", time.Now())
+	return i.db.CreateClient(ctx, client)
+}
+
+func (i *instrumentedDB) ConsumeTokens(ctx context.Context, clientID string, n int, now time.Time, defaultRate float64) (core.Client, bool, error) {
+	defer i.metrics.observeDB("consume_tokens", time.Now())
+	return i.db.ConsumeTokens(ctx, clientID, n, now, defaultRate)
+}
+
+func (i *instrumentedDB) ConsumeWindowLog(ctx context.Context, clientID string, n int, now time.Time, window time.Duration) (core.Client, core.WindowLog, bool, error) {
+	defer i.metrics.observeDB("consume_window_log", time.Now())
+	return i.db.ConsumeWindowLog(ctx, clientID, n, now, window)
+}
+
+func (i *instrumentedDB) ConsumeWindowCounter(ctx context.Context, clientID string, n int, now time.Time, window time.Duration) (core.Client, bool, error) {
+	defer i.metrics.observeDB("consume_window_counter", time.Now())
+	return i.db.ConsumeWindowCounter(ctx, clientID, n, now, window)
+}
+
+func (i *instrumentedDB) ConsumeGCRA(ctx context.Context, clientID string, n int, now time.Time, defaultRate float64) (core.Client, bool, error) {
+	defer i.metrics.observeDB("consume_gcra", time.Now())
+	return i.db.ConsumeGCRA(ctx, clientID, n, now, defaultRate)
+}
+
+func (i *instrumentedDB) UpdateClientCapacity(ctx context.Context, clientID string, capacity int) error {
+	defer i.metrics.observeDB("update_client_capacity", time.Now())
+	return i.db.UpdateClientCapacity(ctx, clientID, capacity)
+}
@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"testtask/limiter/core"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Сколько ждем подсчета клиентов в бд при сборе метрик
+const countTimeout = 2 * time.Second
+
+// Метрики лимитера в формате Prometheus. Лимитер и бд оборачиваются декораторами,
+// которые считают решения и время, поэтому сами реализации про метрики ничего не знают
+type Metrics struct {
+	log          *slog.Logger
+	registry     *prometheus.Registry
+	decisions    *prometheus.CounterVec
+	decisionTime prometheus.Histogram
+	dbTime       *prometheus.HistogramVec
+	top          *topClients
+}
+
+// topN - сколько самых активных клиентов выводить в метриках отдельно, 0 выключает метрики по клиентам
+func New(log *slog.Logger, topN int) *Metrics {
+	m := &Metrics{
+		log:      log,
+		registry: prometheus.NewRegistry(),
+		decisions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "limiter_requests_total",
+			Help: "Rate limit decisions: allowed, rejected or error.",
+		}, []string{"decision"}),
+		decisionTime: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "limiter_decision_duration_seconds",
+			Help:    "Total time of AllowClientRequest.",
+			Buckets: prometheus.DefBuckets,
+		}),
+		dbTime: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "limiter_db_duration_seconds",
+			Help:    "Time of storage operations used by the rate limiter.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"operation"}),
+	}
+
+	m.registry.MustRegister(
+		m.decisions,
+		m.decisionTime,
+		m.dbTime,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	if topN > 0 {
+		m.top = newTopClients(topN)
+		m.registry.MustRegister(m.top)
+	}
+	return m
+}
+
+// Подключает метрику с количеством известных клиентов, значение берется из бд в момент сбора метрик
+func (m *Metrics) RegisterClients(db core.CrudDB) {
+	m.registry.MustRegister(&clientsCollector{log: m.log, db: db})
+}
+
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+func (m *Metrics) observeDecision(clientID string, allowed bool, err error, duration time.Duration) {
+	m.decisionTime.Observe(duration.Seconds())
+
+	decision := "allowed"
+	switch {
+	case err != nil:
+		decision = "error"
+	case !allowed:
+		decision = "rejected"
+	}
+	m.decisions.WithLabelValues(decision).Inc()
+
+	if m.top != nil && err == nil {
+		m.top.add(clientID, allowed)
+	}
+}
+
+func (m *Metrics) observeDB(operation string, start time.Time) {
+	m.dbTime.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+var clientsDesc = prometheus.NewDesc(
+	"limiter_clients",
+	"Number of clients known to the rate limiter.",
+	nil, nil,
+)
+
+type clientsCollector struct {
+	log *slog.Logger
+	db  core.CrudDB
+}
+
+func (c *clientsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- clientsDesc
+}
+
+func (c *clientsCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), countTimeout)
+	defer cancel()
+
+	count, err := c.db.CountClients(ctx)
+	if err != nil {
+		c.log.Error("failed to count clients for metrics", "error", err)
+		ch <- prometheus.NewInvalidMetric(clientsDesc, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(clientsDesc, prometheus.GaugeValue, float64(count))
+}
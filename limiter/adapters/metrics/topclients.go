@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Во сколько раз больше клиентов отслеживаем, чем выводим, чтобы оценка топа была точнее
+const trackFactor = 10
+
+var clientRequestsDesc = prometheus.NewDesc(
+	"limiter_client_requests_total",
+	"Rate limit decisions for the most active clients (approximate).",
+	[]string{"client", "decision"}, nil,
+)
+
+type clientCount struct {
+	allowed  uint64
+	rejected uint64
+	total    uint64
+}
+
+// Приближенный топ самых активных клиентов по алгоритму Space-Saving: отслеживается ограниченное число клиентов,
+// при переполнении вытесняется клиент с наименьшим числом запросов, а новый получает его счетчик.
+// Так память не растет с числом клиентов, а клиенты с большим трафиком в топе не теряются
+type topClients struct {
+	mu       sync.Mutex
+	n        int
+	capacity int
+	counts   map[string]*clientCount
+}
+
+func newTopClients(n int) *topClients {
+	return &topClients{
+		n:        n,
+		capacity: n * trackFactor,
+		counts:   make(map[string]*clientCount, n*trackFactor),
+	}
+}
+
+func (t *topClients) add(clientID string, allowed bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	c, ok := t.counts[clientID]
+	if !ok {
+		c = &clientCount{}
+		if len(t.counts) >= t.capacity {
+			minID, minCount := t.min()
+			delete(t.counts, minID)
+			c.total = minCount.total
+		}
+		t.counts[clientID] = c
+	}
+
+	c.total++
+	if allowed {
+		c.allowed++
+	} else {
+		c.rejected++
+	}
+}
+
+func (t *topClients) min() (string, *clientCount) {
+	var minID string
+	var minCount *clientCount
+	for id, c := range t.counts {
+		if minCount == nil || c.total < minCount.total {
+			minID, minCount = id, c
+		}
+	}
+	return minID, minCount
+}
+
+func (t *topClients) Describe(ch chan<- *prometheus.Desc) {
+	ch <- clientRequestsDesc
+}
+
+func (t *topClients) Collect(ch chan<- prometheus.Metric) {
+	type entry struct {
+		id    string
+		count clientCount
+	}
+
+	t.mu.Lock()
+	entries := make([]entry, 0, len(t.counts))
+	for id, c := range t.counts {
+		entries = append(entries, entry{id: id, count: *c})
+	}
+	t.mu.Unlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].count.total > entries[j].count.total
+	})
+	if len(entries) > t.n {
+		entries = entries[:t.n]
+	}
+
+	for _, e := range entries {
+		ch <- prometheus.MustNewConstMetric(clientRequestsDesc, prometheus.CounterValue, float64(e.count.allowed), e.id, "allowed")
+		ch <- prometheus.MustNewConstMetric(clientRequestsDesc, prometheus.CounterValue, float64(e.count.rejected), e.id, "rejected")
+	}
+}
@@ -0,0 +1,70 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testtask/limiter/config"
+	"testtask/limiter/core"
+	"time"
+)
+
+// GCRA (generic cell rate algorithm): для клиента хранится одно время TAT, до которого "занят" его лимит.
+// Лимит тот же, что у token bucket: capacity запросов подряд и refill_rate запросов в секунду,
+// но решение - одно чтение и запись TAT, а Retry-After вычисляется точно
+type GCRA struct {
+	log         *slog.Logger
+	cfg         config.Config
+	defaultRate float64
+}
+
+func NewGCRA(log *slog.Logger, cfg config.Config) *GCRA {
+	return &GCRA{
+		log:         log,
+		cfg:         cfg,
+		defaultRate: cfg.RateLimit.DefaultRefillRate(),
+	}
+}
+
+func (g *GCRA) AllowClientRequest(ctx context.Context, clientID string, cost int, db core.RateLimiterDB) (core.Decision, error) {
+	now := time.Now()
+
+	client, allowed, err := db.ConsumeGCRA(ctx, clientID, cost, now, g.defaultRate)
+	if errors.Is(err, core.ErrClientNotFound) {
+		if err := createClient(ctx, g.log, g.cfg, db, clientID, now); err != nil {
+			return core.Decision{}, err
+		}
+		client, allowed, err = db.ConsumeGCRA(ctx, clientID, cost, now, g.defaultRate)
+	}
+	if err != nil {
+		return core.Decision{}, err
+	}
+
+	if !allowed {
+		g.log.Debug("rate limit exceeded", "client_id", clientID)
+	}
+	return g.decision(client, allowed, cost, now), nil
+}
+
+// Reset - когда TAT догонит текущее время и лимит восстановится полностью.
+// RetryAfter - когда TAT с n новыми запросами уложится в capacity интервалов
+func (g *GCRA) decision(client core.Client, allowed bool, n int, now time.Time) core.Decision {
+	decision := core.Decision{
+		Allowed: allowed,
+		Limit:   client.Capacity,
+	}
+
+	rate := client.Rate(g.defaultRate)
+	if rate <= 0 {
+		return decision
+	}
+
+	interval := core.EmissionInterval(rate)
+	busy := max(client.TAT.Sub(now), 0)
+	decision.Reset = busy
+	decision.Remaining = max(client.Capacity-int((busy+interval-1)/interval), 0)
+	if !allowed {
+		decision.RetryAfter = max(busy+time.Duration(n-client.Capacity)*interval, 0)
+	}
+	return decision
+}
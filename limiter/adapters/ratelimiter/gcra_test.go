@@ -0,0 +1,99 @@
+package ratelimiter
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"testtask/limiter/config"
+	"testtask/limiter/core"
+	"time"
+)
+
+func newGCRA(rate float64) *GCRA {
+	var cfg config.Config
+	cfg.RateLimit = config.RateLimit{Capacity: 1, RefillRate: rate, Algorithm: core.AlgorithmGCRA}
+	return NewGCRA(slog.New(slog.NewTextHandler(io.Discard, nil)), cfg)
+}
+
+// Запросы идут пачкой, пока не будет отказа. Запрос ровно через Retry-After проходит, на наносекунду раньше - нет
+func TestGCRARetryAfter(t *testing.T) {
+	tests := []struct {
+		name     string
+		capacity int
+		rate     float64
+		cost     int
+	}{
+		{"one per second", 3, 1, 1},
+		{"fractional interval", 5, 3, 1},
+		{"cost above one", 5, 2, 2},
+		{"cost equals capacity", 3, 0.5, 3},
+		{"slow rate", 2, 0.1, 1},
+	}
+	for _, tt := range tests {
+		g := newGCRA(tt.rate)
+		now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		client := core.Client{Capacity: tt.capacity, RefillRate: tt.rate, TAT: now}
+
+		allowed := 0
+		for client.ConsumeGCRA(tt.cost, now, 0) {
+			allowed++
+			d := g.decision(client, true, tt.cost, now)
+			if d.RetryAfter != 0 || d.Remaining != tt.capacity-allowed*tt.cost {
+				t.Fatalf("%s: allowed decision %+v, want remaining %d", tt.name, d, tt.capacity-allowed*tt.cost)
+			}
+		}
+		if allowed != tt.capacity/tt.cost {
+			t.Fatalf("%s: burst of %d requests, want %d", tt.name, allowed, tt.capacity/tt.cost)
+		}
+
+		d := g.decision(client, false, tt.cost, now)
+		if d.Allowed || d.RetryAfter <= 0 || d.Limit != tt.capacity {
+			t.Fatalf("%s: denied decision %+v", tt.name, d)
+		}
+		if d.Reset != client.TAT.Sub(now) {
+			t.Errorf("%s: reset %v, want %v", tt.name, d.Reset, client.TAT.Sub(now))
+		}
+
+		early := client
+		if early.ConsumeGCRA(tt.cost, now.Add(d.RetryAfter-time.Nanosecond), 0) {
+			t.Errorf("%s: allowed before retry after %v", tt.name, d.RetryAfter)
+		}
+		onTime := client
+		if !onTime.ConsumeGCRA(tt.cost, now.Add(d.RetryAfter), 0) {
+			t.Errorf("%s: denied at retry after %v", tt.name, d.RetryAfter)
+		}
+	}
+}
+
+func TestGCRADecision(t *testing.T) {
+	g := newGCRA(2)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	interval := 500 * time.Millisecond
+
+	tests := []struct {
+		name    string
+		tat     time.Time
+		allowed bool
+		cost    int
+		want    core.Decision
+	}{
+		{"idle", now.Add(-time.Second), true, 1, core.Decision{Allowed: true, Limit: 4, Remaining: 4}},
+		{"one interval busy", now.Add(interval), true, 1, core.Decision{Allowed: true, Limit: 4, Remaining: 3, Reset: interval}},
+		// Неполный интервал занимает место целиком
+		{"partial interval", now.Add(interval + time.Millisecond), true, 1, core.Decision{Allowed: true, Limit: 4, Remaining: 2, Reset: interval + time.Millisecond}},
+		{"full", now.Add(4 * interval), false, 1, core.Decision{Limit: 4, Reset: 4 * interval, RetryAfter: interval}},
+		{"full with cost", now.Add(4 * interval), false, 3, core.Decision{Limit: 4, Reset: 4 * interval, RetryAfter: 3 * interval}},
+		{"partly busy with cost", now.Add(3 * interval), false, 2, core.Decision{Limit: 4, Remaining: 1, Reset: 3 * interval, RetryAfter: interval}},
+	}
+	for _, tt := range tests {
+		client := core.Client{Capacity: 4, RefillRate: 2, TAT: tt.tat}
+		if got := g.decision(client, tt.allowed, tt.cost, now); got != tt.want {
+			t.Errorf("%s: decision %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+
+	// Без скорости время сброса и повтора неизвестно
+	if got := newGCRA(0).decision(core.Client{Capacity: 4, TAT: now}, false, 1, now); got != (core.Decision{Limit: 4}) {
+		t.Errorf("no rate: decision %+v", got)
+	}
+}
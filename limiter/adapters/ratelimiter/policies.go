@@ -0,0 +1,71 @@
+package ratelimiter
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testtask/limiter/config"
+	"testtask/limiter/core"
+)
+
+// Префикс клиентов лимита по умолчанию в API решений. Имя зарезервировано и не может быть именем политики
+const defaultPolicy = "default"
+
+// Именованные политики лимита для API решений. Пустое имя - лимит по умолчанию из конфига.
+// Клиенты политики хранятся под ключом "<policy>:<key>", лимита по умолчанию - "default:<key>",
+// поэтому один ключ в разных политиках расходует разные лимиты и не совпадает с клиентами /test
+type Policies struct {
+	limiters map[string]core.RateLimiter
+}
+
+// wrap оборачивает лимитер каждой политики, например, метриками
+func NewPolicies(log *slog.Logger, cfg config.Config, wrap func(core.RateLimiter) core.RateLimiter) (*Policies, error) {
+	p := &Policies{limiters: make(map[string]core.RateLimiter, len(cfg.Policies)+1)}
+
+	selector, err := NewSelector(log, cfg)
+	if err != nil {
+		return nil, err
+	}
+	p.limiters[""] = wrap(selector)
+
+	for name := range cfg.Policies {
+		if name == "" {
+			return nil, fmt.Errorf("policy name must not be empty")
+		}
+		if name == defaultPolicy || strings.Contains(name, ":") {
+			return nil, fmt.Errorf("policy %q: name must not be %q or contain ':'", name, defaultPolicy)
+		}
+		policyCfg := cfg
+		policyCfg.RateLimit, _ = cfg.Policy(name)
+		selector, err := NewSelector(log.With("policy", name), policyCfg)
+		if err != nil {
+			return nil, fmt.Errorf("policy %q: %w", name, err)
+		}
+		p.limiters[name] = wrap(selector)
+	}
+	return p, nil
+}
+
+// Лимитер по умолчанию
+func (p *Policies) Default() core.RateLimiter {
+	return p.limiters[""]
+}
+
+// Задана ли политика с именем name
+func (p *Policies) Has(name string) bool {
+	_, ok := p.limiters[name]
+	return ok
+}
+
+// Списывает cost токенов с ключа key в политике policy
+func (p *Policies) Allow(ctx context.Context, policy, key string, cost int, db core.RateLimiterDB) (core.Decision, error) {
+	limiter, ok := p.limiters[policy]
+	if !ok {
+		return core.Decision{}, core.ErrUnknownPolicy
+	}
+	if policy == "" {
+		policy = defaultPolicy
+	}
+	return limiter.AllowClientRequest(ctx, policy+":"+key, cost, db)
+}
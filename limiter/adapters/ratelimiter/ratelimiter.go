@@ -4,77 +4,83 @@ import (
 	"context"
 	"errors"
 	"log/slog"
-	"sync"
 	"testtask/limiter/config"
 	"testtask/limiter/core"
 	"time"
 )
 
+// Token bucket с непрерывным пополнением. Фонового задания нет: при каждом запросе
+// хранилище досчитывает токены по времени, прошедшему с last_refill клиента, и списывает их одной атомарной операцией
 type RateLimiter struct {
-	interval time.Duration
-	log      *slog.Logger
-	mu       sync.Mutex
-	cfg      config.Config
+	log         *slog.Logger
+	cfg         config.Config
+	defaultRate float64
 }
 
-func New(ctx context.Context, log *slog.Logger, cfg config.Config, db core.RateLimiterDB) *RateLimiter {
-
-	limiter := &RateLimiter{
-		interval: cfg.RateLimit.UpdateInterval,
-		log:      log,
-		cfg:      cfg,
+func New(log *slog.Logger, cfg config.Config) *RateLimiter {
+	return &RateLimiter{
+		log:         log,
+		cfg:         cfg,
+		defaultRate: cfg.RateLimit.DefaultRefillRate(),
 	}
-
-	// В фоне запускаем периодическое пополнение токенов клиентов с заданным воеменным интервалом
-	go limiter.UpdateTokensJob(ctx, limiter.interval, db)
-
-	return limiter
 }
 
-func (rl *RateLimiter) AllowClientRequest(ctx context.Context, clientID string, db core.RateLimiterDB) (bool, error) {
-	client, err := db.GetClient(ctx, clientID)
-	if err != nil {
-		if errors.Is(err, core.ErrClientNotFound) {
-			newClient := core.Client{
-				ClientID: clientID,
-				Capacity: rl.cfg.RateLimit.Capacity,
-				Tokens:   rl.cfg.RateLimit.Capacity - 1,
-			}
-			err = db.CreateClient(ctx, newClient)
-			if err != nil {
-				rl.log.Error("failed to create client", "error", err)
-				return false, err
-			}
-			return true, err
+func (rl *RateLimiter) AllowClientRequest(ctx context.Context, clientID string, cost int, db core.RateLimiterDB) (core.Decision, error) {
+	now := time.Now()
+
+	client, allowed, err := db.ConsumeTokens(ctx, clientID, cost, now, rl.defaultRate)
+	if errors.Is(err, core.ErrClientNotFound) {
+		// Создаем клиента с полным bucket и списываем токены тем же атомарным запросом
+		if err := createClient(ctx, rl.log, rl.cfg, db, clientID, now); err != nil {
+			return core.Decision{}, err
 		}
-		return false, err
+		client, allowed, err = db.ConsumeTokens(ctx, clientID, cost, now, rl.defaultRate)
+	}
+	if err != nil {
+		return core.Decision{}, err
 	}
 
-	if client.Tokens <= 0 {
+	if !allowed {
 		rl.log.Debug("rate limit exceeded", "client_id", clientID)
-		return false, nil
 	}
+	return rl.decision(client, allowed, cost, now), nil
+}
 
-	if err := db.UpdateClientToken(ctx, clientID, client.Tokens-1); err != nil {
-		return false, err
+// Reset - время до полного bucket, RetryAfter - время, когда накопится n токенов
+func (rl *RateLimiter) decision(client core.Client, allowed bool, n int, now time.Time) core.Decision {
+	decision := core.Decision{
+		Allowed:   allowed,
+		Limit:     client.Capacity,
+		Remaining: max(client.Tokens, 0),
 	}
 
-	return true, nil
-}
+	rate := client.Rate(rl.defaultRate)
+	if rate <= 0 {
+		return decision
+	}
 
-func (rl *RateLimiter) UpdateTokensJob(ctx context.Context, interval time.Duration, db core.RateLimiterDB) {
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
+	elapsed := now.Sub(client.LastRefill)
+	decision.Reset = max(core.Seconds(float64(client.Capacity-decision.Remaining)/rate)-elapsed, 0)
+	if !allowed {
+		decision.RetryAfter = max(core.Seconds(float64(n-decision.Remaining)/rate)-elapsed, 0)
+	}
+	return decision
+}
 
-	for {
-		select {
-		case <-ticker.C:
-			rl.mu.Lock()
-			db.UpdateAllTokens(ctx)
-			rl.mu.Unlock()
-		case <-ctx.Done():
-			rl.log.Info("stop token update job")
-			return
-		}
+// Создает клиента с лимитом по умолчанию, полным bucket, пустыми окнами и TAT на текущий момент.
+// Если клиента одновременно создал другой запрос, вставка ничего не сделает
+func createClient(ctx context.Context, log *slog.Logger, cfg config.Config, db core.RateLimiterDB, clientID string, now time.Time) error {
+	client := core.Client{
+		ClientID:    clientID,
+		Capacity:    cfg.RateLimit.Capacity,
+		Tokens:      cfg.RateLimit.Capacity,
+		LastRefill:  now,
+		WindowStart: now,
+		TAT:         now,
+	}
+	if err := db.CreateClient(ctx, client); err != nil {
+		log.Error("failed to create client", "error", err)
+		return err
 	}
+	return nil
 }
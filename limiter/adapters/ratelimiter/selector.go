@@ -0,0 +1,101 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"testtask/limiter/config"
+	"testtask/limiter/core"
+	"time"
+)
+
+// Сколько помнить алгоритм клиента. Изменение алгоритма через CRUD применяется с такой задержкой
+const algorithmTTL = time.Second
+
+// Выбирает алгоритм для каждого клиента: алгоритм из записи клиента, если он задан, иначе алгоритм из конфига.
+// Алгоритм клиента читается из хранилища не чаще раза в algorithmTTL, чтобы решение оставалось одним запросом к хранилищу
+type Selector struct {
+	log       *slog.Logger
+	algorithm string
+	limiters  map[string]core.RateLimiter
+
+	mu         sync.Mutex
+	algorithms map[string]cachedAlgorithm
+	nextSweep  time.Time
+}
+
+type cachedAlgorithm struct {
+	name    string
+	expires time.Time
+}
+
+func NewSelector(log *slog.Logger, cfg config.Config) (*Selector, error) {
+	if !core.IsAlgorithm(cfg.RateLimit.Algorithm) {
+		return nil, fmt.Errorf("unknown rate limit algorithm: %q", cfg.RateLimit.Algorithm)
+	}
+
+	return &Selector{
+		log:       log,
+		algorithm: cfg.RateLimit.Algorithm,
+		limiters: map[string]core.RateLimiter{
+			core.AlgorithmTokenBucket:   New(log, cfg),
+			core.AlgorithmSlidingLog:    NewSlidingLog(log, cfg),
+			core.AlgorithmSlidingWindow: NewSlidingCounter(log, cfg),
+			core.AlgorithmGCRA:          NewGCRA(log, cfg),
+		},
+		algorithms: make(map[string]cachedAlgorithm),
+	}, nil
+}
+
+func (s *Selector) AllowClientRequest(ctx context.Context, clientID string, cost int, db core.RateLimiterDB) (core.Decision, error) {
+	algorithm, err := s.clientAlgorithm(ctx, clientID, db)
+	if err != nil {
+		return core.Decision{}, err
+	}
+
+	limiter, ok := s.limiters[algorithm]
+	if !ok {
+		s.log.Warn("unknown client algorithm, using default", "client_id", clientID, "algorithm", algorithm)
+		limiter = s.limiters[s.algorithm]
+	}
+	return limiter.AllowClientRequest(ctx, clientID, cost, db)
+}
+
+// Возвращает алгоритм клиента из кэша или из хранилища. Для неизвестного клиента - алгоритм по умолчанию
+func (s *Selector) clientAlgorithm(ctx context.Context, clientID string, db core.RateLimiterDB) (string, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	cached, ok := s.algorithms[clientID]
+	s.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.name, nil
+	}
+
+	algorithm := s.algorithm
+	client, err := db.GetClient(ctx, clientID)
+	switch {
+	case err == nil:
+		if client.Algorithm != "" {
+			algorithm = client.Algorithm
+		}
+	case !errors.Is(err, core.ErrClientNotFound):
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Раз в algorithmTTL удаляем устаревшие записи, чтобы кэш не рос вместе с числом когда-либо виденных клиентов
+	if now.After(s.nextSweep) {
+		for id, c := range s.algorithms {
+			if !now.Before(c.expires) {
+				delete(s.algorithms, id)
+			}
+		}
+		s.nextSweep = now.Add(algorithmTTL)
+	}
+	s.algorithms[clientID] = cachedAlgorithm{name: algorithm, expires: now.Add(algorithmTTL)}
+	return algorithm, nil
+}
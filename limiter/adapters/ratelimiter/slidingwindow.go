@@ -0,0 +1,135 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"testtask/limiter/config"
+	"testtask/limiter/core"
+	"time"
+)
+
+// Sliding window log: хранит время каждого запроса клиента и пропускает запрос,
+// если за последние window их было меньше capacity. Точный, но хранит до capacity записей на клиента
+type SlidingLog struct {
+	log    *slog.Logger
+	cfg    config.Config
+	window time.Duration
+}
+
+func NewSlidingLog(log *slog.Logger, cfg config.Config) *SlidingLog {
+	return &SlidingLog{
+		log:    log,
+		cfg:    cfg,
+		window: cfg.RateLimit.Window,
+	}
+}
+
+func (sl *SlidingLog) AllowClientRequest(ctx context.Context, clientID string, cost int, db core.RateLimiterDB) (core.Decision, error) {
+	now := time.Now()
+
+	client, requests, allowed, err := db.ConsumeWindowLog(ctx, clientID, cost, now, sl.window)
+	if errors.Is(err, core.ErrClientNotFound) {
+		if err := createClient(ctx, sl.log, sl.cfg, db, clientID, now); err != nil {
+			return core.Decision{}, err
+		}
+		client, requests, allowed, err = db.ConsumeWindowLog(ctx, clientID, cost, now, sl.window)
+	}
+	if err != nil {
+		return core.Decision{}, err
+	}
+
+	if !allowed {
+		sl.log.Debug("rate limit exceeded", "client_id", clientID)
+	}
+
+	// Место в окне освобождается, когда из него выходит самый старый запрос, а окно пустеет вместе с самым новым.
+	// Для cost больше 1 RetryAfter - нижняя оценка: освободиться может меньше мест, чем нужно
+	decision := core.Decision{
+		Allowed:   allowed,
+		Limit:     client.Capacity,
+		Remaining: max(client.Capacity-requests.Count, 0),
+	}
+	if requests.Count > 0 {
+		decision.Reset = max(requests.Newest.Add(sl.window).Sub(now), 0)
+	}
+	if !allowed {
+		decision.RetryAfter = max(requests.Oldest.Add(sl.window).Sub(now), 0)
+	}
+	return decision, nil
+}
+
+// Sliding window counter: хранит только счетчики текущего и предыдущего окна и оценивает число запросов
+// за последние window, считая, что запросы предыдущего окна распределены в нем равномерно
+type SlidingCounter struct {
+	log    *slog.Logger
+	cfg    config.Config
+	window time.Duration
+}
+
+func NewSlidingCounter(log *slog.Logger, cfg config.Config) *SlidingCounter {
+	return &SlidingCounter{
+		log:    log,
+		cfg:    cfg,
+		window: cfg.RateLimit.Window,
+	}
+}
+
+func (sc *SlidingCounter) AllowClientRequest(ctx context.Context, clientID string, cost int, db core.RateLimiterDB) (core.Decision, error) {
+	now := time.Now()
+
+	client, allowed, err := db.ConsumeWindowCounter(ctx, clientID, cost, now, sc.window)
+	if errors.Is(err, core.ErrClientNotFound) {
+		if err := createClient(ctx, sc.log, sc.cfg, db, clientID, now); err != nil {
+			return core.Decision{}, err
+		}
+		client, allowed, err = db.ConsumeWindowCounter(ctx, clientID, cost, now, sc.window)
+	}
+	if err != nil {
+		return core.Decision{}, err
+	}
+
+	if !allowed {
+		sc.log.Debug("rate limit exceeded", "client_id", clientID)
+	}
+	return sc.decision(client, allowed, cost, now), nil
+}
+
+// Reset - время, когда из оценки уйдут все учтенные запросы: конец следующего окна, если в текущем были запросы,
+// иначе конец текущего. RetryAfter - когда оценка с n новыми запросами перестанет превышать capacity
+func (sc *SlidingCounter) decision(client core.Client, allowed bool, n int, now time.Time) core.Decision {
+	estimate := client.WindowEstimate(now, sc.window)
+	decision := core.Decision{
+		Allowed:   allowed,
+		Limit:     client.Capacity,
+		Remaining: max(client.Capacity-int(math.Ceil(estimate)), 0),
+	}
+
+	elapsed := min(max(now.Sub(client.WindowStart), 0), sc.window)
+	switch {
+	case client.WindowCount > 0:
+		decision.Reset = 2*sc.window - elapsed
+	case client.PrevCount > 0:
+		decision.Reset = sc.window - elapsed
+	}
+
+	if allowed {
+		return decision
+	}
+
+	if threshold, ok := client.WindowThreshold(n, sc.window); ok {
+		// Хватит того, что вес предыдущего окна уменьшится
+		decision.RetryAfter = max(threshold-elapsed, 0)
+		return decision
+	}
+	// Придется ждать следующего окна, в котором текущий счетчик станет предыдущим.
+	// Если n больше capacity, запрос не пройдет никогда, ждем, пока оба окна опустеют
+	next := core.Client{Capacity: client.Capacity, PrevCount: client.WindowCount}
+	threshold, ok := next.WindowThreshold(n, sc.window)
+	if !ok {
+		threshold = sc.window
+	}
+	decision.RetryAfter = sc.window - elapsed + threshold
+	return decision
+}
@@ -0,0 +1,110 @@
+package ratelimiter
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"testtask/limiter/config"
+	"testtask/limiter/core"
+	"time"
+)
+
+func newSlidingCounter(window time.Duration) *SlidingCounter {
+	var cfg config.Config
+	cfg.RateLimit = config.RateLimit{Capacity: 1, Algorithm: core.AlgorithmSlidingWindow, Window: window}
+	return NewSlidingCounter(slog.New(slog.NewTextHandler(io.Discard, nil)), cfg)
+}
+
+// Решение хранилища в памяти: сдвиг окон и проверка оценки
+func consumeWindow(c *core.Client, n int, now time.Time, window time.Duration) bool {
+	c.ShiftWindow(now, window)
+	if !c.WindowAllows(n, now, window) {
+		return false
+	}
+	c.WindowCount += n
+	return true
+}
+
+func TestSlidingCounterDecision(t *testing.T) {
+	window := 10 * time.Second
+	sc := newSlidingCounter(window)
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		client  core.Client
+		now     time.Time
+		allowed bool
+		n       int
+		want    core.Decision
+	}{
+		{"empty", core.Client{Capacity: 5, WindowStart: start}, start, true, 1,
+			core.Decision{Allowed: true, Limit: 5, Remaining: 5}},
+		// Запросы текущего окна уходят из оценки в конце следующего окна
+		{"current window", core.Client{Capacity: 5, WindowStart: start, WindowCount: 2}, start.Add(4 * time.Second), true, 1,
+			core.Decision{Allowed: true, Limit: 5, Remaining: 3, Reset: 16 * time.Second}},
+		{"previous window only", core.Client{Capacity: 5, WindowStart: start, PrevCount: 4}, start.Add(5 * time.Second), true, 1,
+			core.Decision{Allowed: true, Limit: 5, Remaining: 3, Reset: 5 * time.Second}},
+		// free >= 0: хватит уменьшения веса предыдущего окна
+		{"wait for previous weight", core.Client{Capacity: 5, WindowStart: start, PrevCount: 4, WindowCount: 1}, start.Add(2 * time.Second), false, 2,
+			core.Decision{Limit: 5, Remaining: 0, Reset: 18 * time.Second, RetryAfter: 3 * time.Second}},
+		// free < 0: ждем следующего окна, где текущий счетчик станет предыдущим
+		{"wait for next window", core.Client{Capacity: 5, WindowStart: start, PrevCount: 2, WindowCount: 5}, start.Add(4 * time.Second), false, 2,
+			core.Decision{Limit: 5, Remaining: 0, Reset: 16 * time.Second, RetryAfter: 6*time.Second + 4*time.Second}},
+		{"next window with previous weight", core.Client{Capacity: 5, WindowStart: start, WindowCount: 3}, start.Add(4 * time.Second), false, 3,
+			core.Decision{Limit: 5, Remaining: 2, Reset: 16 * time.Second, RetryAfter: 6*time.Second + 3333334*time.Microsecond}},
+		// Запрос дороже capacity не пройдет никогда, ждем, пока оба окна опустеют
+		{"cost above capacity", core.Client{Capacity: 5, WindowStart: start, WindowCount: 1}, start.Add(4 * time.Second), false, 6,
+			core.Decision{Limit: 5, Remaining: 4, Reset: 16 * time.Second, RetryAfter: 16 * time.Second}},
+	}
+	for _, tt := range tests {
+		if got := sc.decision(tt.client, tt.allowed, tt.n, tt.now); got != tt.want {
+			t.Errorf("%s: decision %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// Запрос ровно через Retry-After проходит, на наносекунду раньше - нет
+func TestSlidingCounterRetryAfter(t *testing.T) {
+	window := 10 * time.Second
+	sc := newSlidingCounter(window)
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		client core.Client
+		now    time.Time
+		n      int
+	}{
+		{"previous weight", core.Client{Capacity: 5, WindowStart: start, PrevCount: 4, WindowCount: 1}, start.Add(2 * time.Second), 2},
+		{"rounded threshold", core.Client{Capacity: 5, WindowStart: start, PrevCount: 3, WindowCount: 3}, start.Add(time.Second), 1},
+		{"odd window", core.Client{Capacity: 7, WindowStart: start, PrevCount: 7, WindowCount: 1}, start.Add(123 * time.Millisecond), 3},
+		{"next window", core.Client{Capacity: 5, WindowStart: start, PrevCount: 2, WindowCount: 5}, start.Add(4 * time.Second), 2},
+		{"next window with weight", core.Client{Capacity: 3, WindowStart: start, WindowCount: 3}, start.Add(9 * time.Second), 1},
+		// Окно уже закончилось: сдвиг делает текущий счетчик предыдущим
+		{"shifted window", core.Client{Capacity: 4, WindowStart: start, WindowCount: 4}, start.Add(12 * time.Second), 1},
+		// Через два окна счетчики сбрасываются
+		{"after two windows", core.Client{Capacity: 2, WindowStart: start, PrevCount: 2, WindowCount: 2}, start.Add(25 * time.Second), 2},
+	}
+	for _, tt := range tests {
+		client := tt.client
+		// Заполняем лимит до отказа
+		for consumeWindow(&client, tt.n, tt.now, window) {
+		}
+
+		d := sc.decision(client, false, tt.n, tt.now)
+		if d.RetryAfter <= 0 {
+			t.Errorf("%s: retry after %v, want positive", tt.name, d.RetryAfter)
+			continue
+		}
+
+		early := client
+		if consumeWindow(&early, tt.n, tt.now.Add(d.RetryAfter-time.Nanosecond), window) {
+			t.Errorf("%s: allowed before retry after %v", tt.name, d.RetryAfter)
+		}
+		onTime := client
+		if !consumeWindow(&onTime, tt.n, tt.now.Add(d.RetryAfter), window) {
+			t.Errorf("%s: denied at retry after %v", tt.name, d.RetryAfter)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package redis
+
+import goredis "github.com/redis/go-redis/v9"
+
+// Все изменения состояния клиента выполняются Lua-скриптами на стороне сервера, поэтому каждое решение
+// атомарно и занимает один round-trip. Время передается из Go в микросекундах unix, арифметика повторяет core.Client.
+// Каждый скрипт продлевает ключи клиента на idle_ttl (ARGV[1], мс), ключи неактивных клиентов истекают сами
+
+// Общие функции: продление ключей и ответ в виде признака решения и полей клиента
+const prelude = `
+local function touch(ttl, ...)
+	if tonumber(ttl) > 0 then
+		for _, key in ipairs({...}) do
+			redis.call('PEXPIRE', key, ttl)
+		end
+	end
+end
+
+local function reply(allowed, ...)
+	local result = {allowed, ...}
+	local fields = redis.call('HGETALL', KEYS[1])
+	for _, v in ipairs(fields) do
+		table.insert(result, v)
+	end
+	return result
+end
+`
+
+// KEYS[1] - клиент. ARGV: ttl, поля клиента парами имя-значение
+var createScript = goredis.NewScript(prelude + `
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	return 0
+end
+redis.call('HSET', KEYS[1], unpack(ARGV, 2))
+touch(ARGV[1], KEYS[1])
+return 1
+`)
+
+// KEYS[1] - клиент. ARGV: поле, значение
+var updateScript = goredis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+return 1
+`)
+
+// KEYS[1] - клиент. ARGV: ttl, n, now, скорость по умолчанию
+var tokenBucketScript = goredis.NewScript(prelude + `
+local c = redis.call('HMGET', KEYS[1], 'capacity', 'tokens', 'refill_rate', 'last_refill')
+if not c[1] then
+	return false
+end
+
+local capacity = tonumber(c[1])
+local tokens = tonumber(c[2])
+local rate = tonumber(c[3])
+local last = tonumber(c[4])
+local n = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+if rate <= 0 then
+	rate = tonumber(ARGV[4])
+end
+
+if tokens >= capacity then
+	tokens = capacity
+	last = now
+elseif rate > 0 then
+	local added = math.floor((now - last) / 1e6 * rate)
+	if added > 0 then
+		tokens = tokens + added
+		if tokens >= capacity then
+			tokens = capacity
+			last = now
+		else
+			last = last + math.ceil(added / rate * 1e6)
+		end
+	end
+end
+
+local allowed = 0
+if tokens >= n then
+	tokens = tokens - n
+	allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tokens, 'last_refill', string.format('%d', last))
+touch(ARGV[1], KEYS[1])
+return reply(allowed)
+`)
+
+// KEYS[1] - клиент, KEYS[2] - лог запросов (sorted set, score - время запроса). ARGV: ttl, n, now, window.
+// Члены лога уникальны за счет счетчика seq в клиенте, чтобы одновременные запросы не склеивались
+var windowLogScript = goredis.NewScript(prelude + `
+local capacity = tonumber(redis.call('HGET', KEYS[1], 'capacity'))
+if not capacity then
+	return false
+end
+
+local n = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local window = tonumber(ARGV[4])
+redis.call('ZREMRANGEBYSCORE', KEYS[2], '-inf', string.format('%d', now - window))
+
+local allowed = 0
+if redis.call('ZCARD', KEYS[2]) + n <= capacity then
+	for i = 1, n do
+		local seq = redis.call('HINCRBY', KEYS[1], 'seq', 1)
+		redis.call('ZADD', KEYS[2], string.format('%d', now), seq)
+	end
+	allowed = 1
+end
+
+local count = redis.call('ZCARD', KEYS[2])
+local oldest = now
+local newest = now
+if count > 0 then
+	oldest = tonumber(redis.call('ZRANGE', KEYS[2], 0, 0, 'WITHSCORES')[2])
+	newest = tonumber(redis.call('ZRANGE', KEYS[2], -1, -1, 'WITHSCORES')[2])
+end
+
+touch(ARGV[1], KEYS[1], KEYS[2])
+return reply(allowed, count, string.format('%d', oldest), string.format('%d', newest))
+`)
+
+// KEYS[1] - клиент. ARGV: ttl, n, now, window
+var windowCounterScript = goredis.NewScript(prelude + `
+local c = redis.call('HMGET', KEYS[1], 'capacity', 'window_start', 'window_count', 'prev_count')
+if not c[1] then
+	return false
+end
+
+local capacity = tonumber(c[1])
+local start = tonumber(c[2])
+local count = tonumber(c[3])
+local prev = tonumber(c[4])
+local n = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local window = tonumber(ARGV[4])
+
+local elapsed = now - start
+if elapsed >= 2 * window then
+	start = now
+	prev = 0
+	count = 0
+elseif elapsed >= window then
+	start = start + window
+	prev = count
+	count = 0
+end
+
+-- Порог считается как в core.Client.WindowThreshold, в микросекундах
+local allowed = 0
+local free = capacity - count - n
+if free >= 0 then
+	local threshold = 0
+	if prev > free then
+		threshold = math.ceil(window * (prev - free) / prev)
+	end
+	if now - start >= threshold then
+		count = count + n
+		allowed = 1
+	end
+end
+
+redis.call('HSET', KEYS[1], 'window_start', string.format('%d', start), 'window_count', count, 'prev_count', prev)
+touch(ARGV[1], KEYS[1])
+return reply(allowed)
+`)
+
+// KEYS[1] - клиент. ARGV: ttl, n, now, скорость по умолчанию
+var gcraScript = goredis.NewScript(prelude + `
+local c = redis.call('HMGET', KEYS[1], 'capacity', 'refill_rate', 'tat')
+if not c[1] then
+	return false
+end
+
+local capacity = tonumber(c[1])
+local rate = tonumber(c[2])
+local tat = tonumber(c[3])
+local n = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+if rate <= 0 then
+	rate = tonumber(ARGV[4])
+end
+
+local allowed = 0
+if rate > 0 then
+	local interval = math.ceil(1e6 / rate)
+	local arrival = math.max(tat, now) + n * interval
+	if arrival - now <= capacity * interval then
+		redis.call('HSET', KEYS[1], 'tat', string.format('%d', arrival))
+		allowed = 1
+	end
+end
+
+touch(ARGV[1], KEYS[1])
+return reply(allowed)
+`)
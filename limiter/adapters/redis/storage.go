@@ -0,0 +1,281 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"testtask/limiter/core"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// Хранилище клиентов в Redis или совместимом с ним сервере. Клиент хранится в hash prefix+"client:{id}",
+// лог запросов sliding window log - в sorted set prefix+"log:{id}". Id в фигурных скобках - hash tag,
+// в Redis Cluster оба ключа клиента попадают в один слот и скрипт может работать с ними вместе.
+// Ключи клиента, к которому не было запросов дольше idleTTL, удаляются сервером, в том числе созданные через CRUD
+type Storage struct {
+	log     *slog.Logger
+	client  *goredis.Client
+	prefix  string
+	idleTTL time.Duration
+}
+
+func New(log *slog.Logger, address, password string, db int, prefix string, idleTTL time.Duration) (*Storage, error) {
+	client := goredis.NewClient(&goredis.Options{
+		Addr:     address,
+		Password: password,
+		DB:       db,
+	})
+
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		log.Error("connection problem", "address", address, "error", err)
+		client.Close()
+		return nil, err
+	}
+
+	return &Storage{
+		log:     log,
+		client:  client,
+		prefix:  prefix,
+		idleTTL: idleTTL,
+	}, nil
+}
+
+func (s *Storage) Close() error {
+	s.log.Debug("closing redis connection pool")
+	return s.client.Close()
+}
+
+func (s *Storage) clientKey(clientID string) string {
+	return s.prefix + "client:{" + clientID + "}"
+}
+
+func (s *Storage) logKey(clientID string) string {
+	return s.prefix + "log:{" + clientID + "}"
+}
+
+func (s *Storage) ttl() int64 {
+	return s.idleTTL.Milliseconds()
+}
+
+func (s *Storage) GetClient(ctx context.Context, clientID string) (core.Client, error) {
+	fields, err := s.client.HGetAll(ctx, s.clientKey(clientID)).Result()
+	if err != nil {
+		s.log.Error("failed to get client", "client_id", clientID, "error", err)
+		return core.Client{}, err
+	}
+	if len(fields) == 0 {
+		return core.Client{}, core.ErrClientNotFound
+	}
+	return parseClient(clientID, fields)
+}
+
+// Обходит ключи клиентов через SCAN, чтобы не блокировать сервер на больших базах
+func (s *Storage) GetAllClients(ctx context.Context) ([]core.Client, error) {
+	var clients []core.Client
+	err := s.scanClients(ctx, func(clientID string) error {
+		client, err := s.GetClient(ctx, clientID)
+		if errors.Is(err, core.ErrClientNotFound) {
+			// Ключ истек между SCAN и чтением
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		clients = append(clients, client)
+		return nil
+	})
+	if err != nil {
+		s.log.Error("failed to get clients", "error", err)
+		return nil, err
+	}
+	return clients, nil
+}
+
+func (s *Storage) CountClients(ctx context.Context) (int, error) {
+	count := 0
+	err := s.scanClients(ctx, func(string) error {
+		count++
+		return nil
+	})
+	if err != nil {
+		s.log.Error("failed to count clients", "error", err)
+		return 0, err
+	}
+	return count, nil
+}
+
+func (s *Storage) scanClients(ctx context.Context, fn func(clientID string) error) error {
+	prefix := s.prefix + "client:{"
+	iter := s.client.Scan(ctx, 0, prefix+"*}", 1000).Iterator()
+	for iter.Next(ctx) {
+		if err := fn(strings.TrimSuffix(iter.Val()[len(prefix):], "}")); err != nil {
+			return err
+		}
+	}
+	return iter.Err()
+}
+
+// Как и в postgres, существующий клиент не перезаписывается
+func (s *Storage) CreateClient(ctx context.Context, client core.Client) error {
+	args := []any{s.ttl(),
+		"capacity", client.Capacity,
+		"tokens", client.Tokens,
+		"refill_rate", client.RefillRate,
+		"last_refill", client.LastRefill.UnixMicro(),
+		"algorithm", client.Algorithm,
+		"window_start", client.WindowStart.UnixMicro(),
+		"window_count", client.WindowCount,
+		"prev_count", client.PrevCount,
+		"tat", client.TAT.UnixMicro(),
+	}
+	if err := createScript.Run(ctx, s.client, []string{s.clientKey(client.ClientID)}, args...).Err(); err != nil {
+		s.log.Error("failed to create client", "client_id", client.ClientID, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (s *Storage) RemoveClient(ctx context.Context, clientID string) error {
+	removed, err := s.client.Del(ctx, s.clientKey(clientID), s.logKey(clientID)).Result()
+	if err != nil {
+		s.log.Error("failed to delete client", "client_id", clientID, "error", err)
+		return err
+	}
+	if removed == 0 {
+		return core.ErrClientNotFound
+	}
+	return nil
+}
+
+func (s *Storage) UpdateClientCapacity(ctx context.Context, clientID string, capacity int) error {
+	return s.updateField(ctx, clientID, "capacity", capacity)
+}
+
+func (s *Storage) UpdateClientRefillRate(ctx context.Context, clientID string, rate float64) error {
+	return s.updateField(ctx, clientID, "refill_rate", rate)
+}
+
+func (s *Storage) UpdateClientAlgorithm(ctx context.Context, clientID string, algorithm string) error {
+	return s.updateField(ctx, clientID, "algorithm", algorithm)
+}
+
+func (s *Storage) updateField(ctx context.Context, clientID string, field string, value any) error {
+	updated, err := updateScript.Run(ctx, s.client, []string{s.clientKey(clientID)}, field, value).Int()
+	if err != nil {
+		s.log.Error("failed to update client", "client_id", clientID, "field", field, "error", err)
+		return err
+	}
+	if updated == 0 {
+		s.log.Warn("client not found", "client_id", clientID)
+		return core.ErrClientNotFound
+	}
+	return nil
+}
+
+func (s *Storage) ConsumeTokens(ctx context.Context, clientID string, n int, now time.Time, defaultRate float64) (core.Client, bool, error) {
+	result, err := s.run(ctx, tokenBucketScript, clientID, []string{s.clientKey(clientID)}, n, now.UnixMicro(), defaultRate)
+	if err != nil {
+		return core.Client{}, false, err
+	}
+	client, err := parseClient(clientID, pairs(result[1:]))
+	return client, result[0] == int64(1), err
+}
+
+func (s *Storage) ConsumeWindowLog(ctx context.Context, clientID string, n int, now time.Time, window time.Duration) (core.Client, core.WindowLog, bool, error) {
+	keys := []string{s.clientKey(clientID), s.logKey(clientID)}
+	result, err := s.run(ctx, windowLogScript, clientID, keys, n, now.UnixMicro(), window.Microseconds())
+	if err != nil {
+		return core.Client{}, core.WindowLog{}, false, err
+	}
+	if len(result) < 4 {
+		return core.Client{}, core.WindowLog{}, false, fmt.Errorf("unexpected script reply: %v", result)
+	}
+
+	count, _ := result[1].(int64)
+	oldest, _ := strconv.ParseInt(fmt.Sprint(result[2]), 10, 64)
+	newest, _ := strconv.ParseInt(fmt.Sprint(result[3]), 10, 64)
+	requests := core.WindowLog{
+		Count:  int(count),
+		Oldest: time.UnixMicro(oldest),
+		Newest: time.UnixMicro(newest),
+	}
+
+	client, err := parseClient(clientID, pairs(result[4:]))
+	return client, requests, result[0] == int64(1), err
+}
+
+func (s *Storage) ConsumeWindowCounter(ctx context.Context, clientID string, n int, now time.Time, window time.Duration) (core.Client, bool, error) {
+	result, err := s.run(ctx, windowCounterScript, clientID, []string{s.clientKey(clientID)}, n, now.UnixMicro(), window.Microseconds())
+	if err != nil {
+		return core.Client{}, false, err
+	}
+	client, err := parseClient(clientID, pairs(result[1:]))
+	return client, result[0] == int64(1), err
+}
+
+func (s *Storage) ConsumeGCRA(ctx context.Context, clientID string, n int, now time.Time, defaultRate float64) (core.Client, bool, error) {
+	result, err := s.run(ctx, gcraScript, clientID, []string{s.clientKey(clientID)}, n, now.UnixMicro(), defaultRate)
+	if err != nil {
+		return core.Client{}, false, err
+	}
+	client, err := parseClient(clientID, pairs(result[1:]))
+	return client, result[0] == int64(1), err
+}
+
+// Выполняет скрипт решения. Скрипт возвращает nil, если клиента нет
+func (s *Storage) run(ctx context.Context, script *goredis.Script, clientID string, keys []string, args ...any) ([]any, error) {
+	result, err := script.Run(ctx, s.client, keys, append([]any{s.ttl()}, args...)...).Slice()
+	if errors.Is(err, goredis.Nil) {
+		return nil, core.ErrClientNotFound
+	}
+	if err != nil {
+		s.log.Error("failed to run script", "client_id", clientID, "error", err)
+		return nil, err
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("empty script reply")
+	}
+	return result, nil
+}
+
+// Собирает плоский список имя-значение из ответа скрипта в map
+func pairs(values []any) map[string]string {
+	fields := make(map[string]string, len(values)/2)
+	for i := 0; i+1 < len(values); i += 2 {
+		fields[fmt.Sprint(values[i])] = fmt.Sprint(values[i+1])
+	}
+	return fields
+}
+
+func parseClient(clientID string, fields map[string]string) (core.Client, error) {
+	var (
+		client = core.Client{ClientID: clientID, Algorithm: fields["algorithm"]}
+		errs   []error
+	)
+	number := func(name string) float64 {
+		v, err := strconv.ParseFloat(fields[name], 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("field %s: %w", name, err))
+		}
+		return v
+	}
+	micro := func(name string) time.Time {
+		return time.UnixMicro(int64(number(name)))
+	}
+
+	client.Capacity = int(number("capacity"))
+	client.Tokens = int(number("tokens"))
+	client.RefillRate = number("refill_rate")
+	client.LastRefill = micro("last_refill")
+	client.WindowStart = micro("window_start")
+	client.WindowCount = int(number("window_count"))
+	client.PrevCount = int(number("prev_count"))
+	client.TAT = micro("tat")
+
+	return client, errors.Join(errs...)
+}
@@ -0,0 +1,229 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"testtask/limiter/core"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// Скрипты выполняются в miniredis, который поддерживает EVALSHA и Lua
+func newStorage(t *testing.T) (*Storage, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s, err := New(log, server.Addr(), "", 0, "test:", time.Minute)
+	if err != nil {
+		t.Fatalf("new storage: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s, server
+}
+
+func createClient(t *testing.T, s *Storage, client core.Client) {
+	t.Helper()
+	if err := s.CreateClient(context.Background(), client); err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+}
+
+func TestCreateClient(t *testing.T) {
+	s, server := newStorage(t)
+	ctx := context.Background()
+	now := time.UnixMicro(time.Now().UnixMicro())
+
+	client := core.Client{ClientID: "client", Capacity: 5, Tokens: 3, RefillRate: 1.5, LastRefill: now, Algorithm: core.AlgorithmGCRA, WindowStart: now, TAT: now}
+	createClient(t, s, client)
+	// Существующий клиент не перезаписывается
+	createClient(t, s, core.Client{ClientID: "client", Capacity: 100, Tokens: 100, LastRefill: now, WindowStart: now, TAT: now})
+
+	got, err := s.GetClient(ctx, "client")
+	if err != nil {
+		t.Fatalf("get client: %v", err)
+	}
+	if got != client {
+		t.Fatalf("got %+v, want %+v", got, client)
+	}
+
+	if !server.Exists("test:client:{client}") {
+		t.Fatalf("client key is not hash-tagged: %v", server.Keys())
+	}
+	clients, err := s.GetAllClients(ctx)
+	if err != nil || len(clients) != 1 || clients[0].ClientID != "client" {
+		t.Fatalf("get all clients: %v, %v", clients, err)
+	}
+
+	if err := s.UpdateClientAlgorithm(ctx, "missing", core.AlgorithmGCRA); !errors.Is(err, core.ErrClientNotFound) {
+		t.Fatalf("update missing client: %v", err)
+	}
+	if _, _, err := s.ConsumeTokens(ctx, "missing", 1, now, 0); !errors.Is(err, core.ErrClientNotFound) {
+		t.Fatalf("consume missing client: %v", err)
+	}
+}
+
+func TestConsumeTokens(t *testing.T) {
+	s, _ := newStorage(t)
+	ctx := context.Background()
+	now := time.UnixMicro(time.Now().UnixMicro())
+	createClient(t, s, core.Client{ClientID: "client", Capacity: 3, Tokens: 3, RefillRate: 1, LastRefill: now, WindowStart: now, TAT: now})
+
+	for i := range 3 {
+		if _, ok, err := s.ConsumeTokens(ctx, "client", 1, now, 0); err != nil || !ok {
+			t.Fatalf("request %d: allowed %v, error %v", i, ok, err)
+		}
+	}
+	client, ok, err := s.ConsumeTokens(ctx, "client", 1, now, 0)
+	if err != nil || ok {
+		t.Fatalf("request over capacity: allowed %v, error %v", ok, err)
+	}
+	if client.Tokens != 0 {
+		t.Fatalf("tokens %d, want 0", client.Tokens)
+	}
+
+	// За 1.5 секунды при скорости 1 токен в секунду добавляется один токен, дробная часть остается в last_refill
+	later := now.Add(1500 * time.Millisecond)
+	client, ok, err = s.ConsumeTokens(ctx, "client", 1, later, 0)
+	if err != nil || !ok {
+		t.Fatalf("request after refill: allowed %v, error %v", ok, err)
+	}
+	if client.Tokens != 0 || !client.LastRefill.Equal(now.Add(time.Second)) {
+		t.Fatalf("tokens %d, last refill %v, want 0 and %v", client.Tokens, client.LastRefill, now.Add(time.Second))
+	}
+}
+
+func TestConsumeWindowLog(t *testing.T) {
+	s, server := newStorage(t)
+	ctx := context.Background()
+	start := time.UnixMicro(time.Now().UnixMicro())
+	window := 10 * time.Second
+	createClient(t, s, core.Client{ClientID: "client", Capacity: 3, Tokens: 3, LastRefill: start, WindowStart: start, TAT: start})
+
+	if _, _, ok, err := s.ConsumeWindowLog(ctx, "client", 2, start, window); err != nil || !ok {
+		t.Fatalf("first request: allowed %v, error %v", ok, err)
+	}
+	if _, _, ok, err := s.ConsumeWindowLog(ctx, "client", 1, start.Add(time.Second), window); err != nil || !ok {
+		t.Fatalf("second request: allowed %v, error %v", ok, err)
+	}
+	_, requests, ok, err := s.ConsumeWindowLog(ctx, "client", 1, start.Add(2*time.Second), window)
+	if err != nil || ok {
+		t.Fatalf("request over capacity: allowed %v, error %v", ok, err)
+	}
+	if requests.Count != 3 || !requests.Oldest.Equal(start) || !requests.Newest.Equal(start.Add(time.Second)) {
+		t.Fatalf("log %+v, want 3 requests from %v to %v", requests, start, start.Add(time.Second))
+	}
+	if !server.Exists("test:log:{client}") {
+		t.Fatalf("log key is not hash-tagged: %v", server.Keys())
+	}
+
+	// Через окно запросы первого вызова истекают, остается один
+	_, requests, ok, err = s.ConsumeWindowLog(ctx, "client", 2, start.Add(window), window)
+	if err != nil || !ok {
+		t.Fatalf("request after window: allowed %v, error %v", ok, err)
+	}
+	if requests.Count != 3 || !requests.Oldest.Equal(start.Add(time.Second)) || !requests.Newest.Equal(start.Add(window)) {
+		t.Fatalf("log %+v, want 3 requests from %v to %v", requests, start.Add(time.Second), start.Add(window))
+	}
+}
+
+func TestConsumeWindowCounter(t *testing.T) {
+	s, _ := newStorage(t)
+	ctx := context.Background()
+	start := time.UnixMicro(time.Now().UnixMicro())
+	window := 10 * time.Second
+	createClient(t, s, core.Client{ClientID: "client", Capacity: 4, Tokens: 4, LastRefill: start, WindowStart: start, TAT: start})
+
+	if _, ok, err := s.ConsumeWindowCounter(ctx, "client", 4, start, window); err != nil || !ok {
+		t.Fatalf("first request: allowed %v, error %v", ok, err)
+	}
+	if _, ok, err := s.ConsumeWindowCounter(ctx, "client", 1, start.Add(time.Second), window); err != nil || ok {
+		t.Fatalf("request over capacity: allowed %v, error %v", ok, err)
+	}
+
+	// В середине следующего окна предыдущее учитывается наполовину: 4 * 0.5 + 2 = 4
+	client, ok, err := s.ConsumeWindowCounter(ctx, "client", 2, start.Add(15*time.Second), window)
+	if err != nil || !ok {
+		t.Fatalf("request in next window: allowed %v, error %v", ok, err)
+	}
+	if client.PrevCount != 4 || client.WindowCount != 2 || !client.WindowStart.Equal(start.Add(window)) {
+		t.Fatalf("counter %+v, want prev 4, count 2, start %v", client, start.Add(window))
+	}
+	if _, ok, err := s.ConsumeWindowCounter(ctx, "client", 1, start.Add(15*time.Second), window); err != nil || ok {
+		t.Fatalf("request over estimate: allowed %v, error %v", ok, err)
+	}
+
+	// Через два окна счетчики сбрасываются
+	client, ok, err = s.ConsumeWindowCounter(ctx, "client", 4, start.Add(30*time.Second), window)
+	if err != nil || !ok {
+		t.Fatalf("request after two windows: allowed %v, error %v", ok, err)
+	}
+	if client.PrevCount != 0 || client.WindowCount != 4 {
+		t.Fatalf("counter %+v, want prev 0, count 4", client)
+	}
+}
+
+func TestConsumeGCRA(t *testing.T) {
+	s, _ := newStorage(t)
+	ctx := context.Background()
+	now := time.UnixMicro(time.Now().UnixMicro())
+	createClient(t, s, core.Client{ClientID: "client", Capacity: 2, Tokens: 2, RefillRate: 1, LastRefill: now, WindowStart: now, TAT: now})
+
+	for i := range 2 {
+		if _, ok, err := s.ConsumeGCRA(ctx, "client", 1, now, 0); err != nil || !ok {
+			t.Fatalf("request %d: allowed %v, error %v", i, ok, err)
+		}
+	}
+	client, ok, err := s.ConsumeGCRA(ctx, "client", 1, now, 0)
+	if err != nil || ok {
+		t.Fatalf("request over burst: allowed %v, error %v", ok, err)
+	}
+	if !client.TAT.Equal(now.Add(2 * time.Second)) {
+		t.Fatalf("tat %v, want %v", client.TAT, now.Add(2*time.Second))
+	}
+
+	if _, ok, err := s.ConsumeGCRA(ctx, "client", 1, now.Add(time.Second), 0); err != nil || !ok {
+		t.Fatalf("request after interval: allowed %v, error %v", ok, err)
+	}
+
+	// Без скорости у клиента и по умолчанию запросы не пропускаются
+	createClient(t, s, core.Client{ClientID: "norate", Capacity: 2, Tokens: 2, LastRefill: now, WindowStart: now, TAT: now})
+	if _, ok, err := s.ConsumeGCRA(ctx, "norate", 1, now, 0); err != nil || ok {
+		t.Fatalf("request without rate: allowed %v, error %v", ok, err)
+	}
+}
+
+// Ключи клиента продлеваются на idle_ttl при каждом решении и истекают после простоя
+func TestIdleTTL(t *testing.T) {
+	s, server := newStorage(t)
+	ctx := context.Background()
+	now := time.UnixMicro(time.Now().UnixMicro())
+	createClient(t, s, core.Client{ClientID: "client", Capacity: 3, Tokens: 3, LastRefill: now, WindowStart: now, TAT: now})
+
+	server.FastForward(40 * time.Second)
+	if _, _, _, err := s.ConsumeWindowLog(ctx, "client", 1, now, 10*time.Second); err != nil {
+		t.Fatalf("consume window log: %v", err)
+	}
+	if ttl := server.TTL("test:client:{client}"); ttl != time.Minute {
+		t.Fatalf("client ttl %v, want %v", ttl, time.Minute)
+	}
+	if ttl := server.TTL("test:log:{client}"); ttl != time.Minute {
+		t.Fatalf("log ttl %v, want %v", ttl, time.Minute)
+	}
+
+	server.FastForward(40 * time.Second)
+	if _, err := s.GetClient(ctx, "client"); err != nil {
+		t.Fatalf("client expired before idle_ttl: %v", err)
+	}
+
+	server.FastForward(30 * time.Second)
+	if _, err := s.GetClient(ctx, "client"); !errors.Is(err, core.ErrClientNotFound) {
+		t.Fatalf("get expired client: %v", err)
+	}
+	if server.Exists("test:log:{client}") {
+		t.Fatal("log key did not expire")
+	}
+}
@@ -0,0 +1,127 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"testtask/limiter/adapters/ratelimiter"
+	"testtask/limiter/core"
+)
+
+const (
+	// Максимальное число ключей в одном пакетном запросе
+	maxBatchSize = 100
+	// Максимальный размер тела запроса решения, пакет из maxBatchSize ключей в него помещается с запасом
+	maxDecisionBody = 1 << 20
+)
+
+// DecisionHandler - POST /decisions
+// Списывает cost токенов (по умолчанию 1) с ключа key в политике policy и возвращает решение
+// Принимает JSON вида:
+// {"key": "string", "cost": int, "policy": "string"}
+func DecisionHandler(log *slog.Logger, policies *ratelimiter.Policies, db core.RateLimiterDB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req core.DecisionRequest
+		if !decodeBody(log, w, r, &req) {
+			return
+		}
+
+		resp, err := decide(r, policies, db, req)
+		if err != nil {
+			switch {
+			case errors.Is(err, errInvalidDecision):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			case errors.Is(err, core.ErrUnknownPolicy):
+				http.Error(w, "unknown policy", http.StatusBadRequest)
+			default:
+				log.Error("failed to make decision", "key", req.Key, "policy", req.Policy, "error", err)
+				http.Error(w, "failed to make decision", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// BatchDecisionHandler - POST /decisions/batch
+// Проверяет несколько ключей за один вызов, каждый ключ списывается независимо от остальных.
+// Ошибка по отдельному ключу возвращается в поле error его результата
+// Принимает JSON вида:
+// {"requests": [{"key": "string", "cost": int, "policy": "string"}]}
+func BatchDecisionHandler(log *slog.Logger, policies *ratelimiter.Policies, db core.RateLimiterDB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Requests []core.DecisionRequest `json:"requests"`
+		}
+		if !decodeBody(log, w, r, &req) {
+			return
+		}
+		if len(req.Requests) == 0 || len(req.Requests) > maxBatchSize {
+			http.Error(w, "requests must contain from 1 to 100 items", http.StatusBadRequest)
+			return
+		}
+
+		results := make([]core.DecisionResponse, 0, len(req.Requests))
+		for _, item := range req.Requests {
+			resp, err := decide(r, policies, db, item)
+			if err != nil {
+				if !errors.Is(err, errInvalidDecision) && !errors.Is(err, core.ErrUnknownPolicy) {
+					log.Error("failed to make decision", "key", item.Key, "policy", item.Policy, "error", err)
+					err = errors.New("failed to make decision")
+				}
+				resp = core.DecisionResponse{Key: item.Key, Policy: item.Policy, Error: err.Error()}
+			}
+			results = append(results, resp)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string][]core.DecisionResponse{"results": results})
+	}
+}
+
+var errInvalidDecision = errors.New("key is required and cost must be positive")
+
+func decide(r *http.Request, policies *ratelimiter.Policies, db core.RateLimiterDB, req core.DecisionRequest) (core.DecisionResponse, error) {
+	if req.Cost == 0 {
+		req.Cost = 1
+	}
+	if req.Key == "" || req.Cost < 0 {
+		return core.DecisionResponse{}, errInvalidDecision
+	}
+
+	decision, err := policies.Allow(r.Context(), req.Policy, req.Key, req.Cost, db)
+	if err != nil {
+		return core.DecisionResponse{}, err
+	}
+	return core.DecisionResponse{
+		Key:        req.Key,
+		Policy:     req.Policy,
+		Allowed:    decision.Allowed,
+		Limit:      decision.Limit,
+		Remaining:  decision.Remaining,
+		Reset:      decision.Reset.Seconds(),
+		RetryAfter: decision.RetryAfter.Seconds(),
+	}, nil
+}
+
+// Читает JSON тела не больше maxDecisionBody, чтобы вызывающий сервис не мог занять память лимитера.
+// При ошибке отвечает клиенту сам и возвращает false
+func decodeBody(log *slog.Logger, w http.ResponseWriter, r *http.Request, v any) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxDecisionBody)
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err == nil {
+		return true
+	}
+
+	log.Error("failed to decode request", "error", err)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return false
+	}
+	http.Error(w, "invalid request body", http.StatusBadRequest)
+	return false
+}
@@ -0,0 +1,193 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testtask/limiter/adapters/memory"
+	"testtask/limiter/adapters/ratelimiter"
+	"testtask/limiter/config"
+	"testtask/limiter/core"
+	"time"
+)
+
+// Лимит по умолчанию - 5 запросов в час, политика api - 10
+func newDecisionMux(t *testing.T) (*http.ServeMux, *memory.Storage) {
+	t.Helper()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	var cfg config.Config
+	cfg.RateLimit = config.RateLimit{Capacity: 5, UpdateInterval: time.Hour, Algorithm: core.AlgorithmTokenBucket, Window: time.Minute}
+	cfg.Policies = map[string]config.RateLimit{"api": {Capacity: 10}}
+	policies, err := ratelimiter.NewPolicies(log, cfg, func(rl core.RateLimiter) core.RateLimiter { return rl })
+	if err != nil {
+		t.Fatalf("new policies: %v", err)
+	}
+	db, err := memory.New(log, 1, "")
+	if err != nil {
+		t.Fatalf("new storage: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /decisions", DecisionHandler(log, policies, db))
+	mux.HandleFunc("POST /decisions/batch", BatchDecisionHandler(log, policies, db))
+	return mux, db
+}
+
+func post(mux *http.ServeMux, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+	return w
+}
+
+func decodeDecision(t *testing.T, w *httptest.ResponseRecorder) core.DecisionResponse {
+	t.Helper()
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, body %q", w.Code, w.Body.String())
+	}
+	var resp core.DecisionResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	return resp
+}
+
+func TestDecision(t *testing.T) {
+	mux, _ := newDecisionMux(t)
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		remain int
+	}{
+		{"default cost", `{"key":"a"}`, http.StatusOK, 4},
+		{"zero cost", `{"key":"b","cost":0}`, http.StatusOK, 4},
+		{"cost", `{"key":"c","cost":3}`, http.StatusOK, 2},
+		{"policy", `{"key":"d","policy":"api","cost":3}`, http.StatusOK, 7},
+		{"negative cost", `{"key":"e","cost":-1}`, http.StatusBadRequest, 0},
+		{"empty key", `{"key":"","cost":1}`, http.StatusBadRequest, 0},
+		{"unknown policy", `{"key":"f","policy":"missing"}`, http.StatusBadRequest, 0},
+		{"invalid json", `{"key":`, http.StatusBadRequest, 0},
+		{"too large", `{"key":"` + strings.Repeat("a", maxDecisionBody) + `"}`, http.StatusRequestEntityTooLarge, 0},
+	}
+	for _, tt := range tests {
+		w := post(mux, "/decisions", tt.body)
+		if w.Code != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.status)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		if resp := decodeDecision(t, w); !resp.Allowed || resp.Remaining != tt.remain {
+			t.Errorf("%s: allowed %v, remaining %d, want true and %d", tt.name, resp.Allowed, resp.Remaining, tt.remain)
+		}
+	}
+}
+
+func TestDecisionOverLimit(t *testing.T) {
+	mux, _ := newDecisionMux(t)
+
+	decodeDecision(t, post(mux, "/decisions", `{"key":"a","cost":5}`))
+	resp := decodeDecision(t, post(mux, "/decisions", `{"key":"a"}`))
+	if resp.Allowed || resp.Remaining != 0 || resp.RetryAfter <= 0 {
+		t.Fatalf("allowed %v, remaining %d, retry after %v, want false, 0 and positive", resp.Allowed, resp.Remaining, resp.RetryAfter)
+	}
+}
+
+// Один ключ в разных политиках и в лимите по умолчанию расходует разные bucket и не совпадает с клиентом /test
+func TestDecisionNamespaces(t *testing.T) {
+	mux, db := newDecisionMux(t)
+
+	for range 2 {
+		decodeDecision(t, post(mux, "/decisions", `{"key":"k"}`))
+	}
+	if resp := decodeDecision(t, post(mux, "/decisions", `{"key":"k","policy":"api"}`)); resp.Remaining != 9 {
+		t.Fatalf("api policy remaining %d, want 9", resp.Remaining)
+	}
+	if resp := decodeDecision(t, post(mux, "/decisions", `{"key":"k"}`)); resp.Remaining != 2 {
+		t.Fatalf("default remaining %d, want 2", resp.Remaining)
+	}
+
+	ctx := context.Background()
+	for _, id := range []string{"default:k", "api:k"} {
+		if _, err := db.GetClient(ctx, id); err != nil {
+			t.Fatalf("client %q: %v", id, err)
+		}
+	}
+	if _, err := db.GetClient(ctx, "k"); !errors.Is(err, core.ErrClientNotFound) {
+		t.Fatalf("client with raw key: %v, want %v", err, core.ErrClientNotFound)
+	}
+}
+
+func TestBatchDecision(t *testing.T) {
+	mux, _ := newDecisionMux(t)
+
+	w := post(mux, "/decisions/batch", `{"requests":[
+		{"key":"a"},
+		{"key":"a","policy":"missing"},
+		{"key":"","cost":1},
+		{"key":"b","policy":"api","cost":0}
+	]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, body %q", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Results []core.DecisionResponse `json:"results"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(resp.Results) != 4 {
+		t.Fatalf("got %d results, want 4", len(resp.Results))
+	}
+
+	if r := resp.Results[0]; r.Error != "" || !r.Allowed || r.Remaining != 4 {
+		t.Errorf("default policy: %+v", r)
+	}
+	if r := resp.Results[1]; r.Error != core.ErrUnknownPolicy.Error() || r.Allowed || r.Policy != "missing" {
+		t.Errorf("unknown policy: %+v", r)
+	}
+	if r := resp.Results[2]; r.Error != errInvalidDecision.Error() || r.Allowed {
+		t.Errorf("empty key: %+v", r)
+	}
+	if r := resp.Results[3]; r.Error != "" || !r.Allowed || r.Remaining != 9 {
+		t.Errorf("api policy with zero cost: %+v", r)
+	}
+}
+
+func TestBatchDecisionSize(t *testing.T) {
+	mux, _ := newDecisionMux(t)
+
+	batch := func(n int) string {
+		items := make([]string, n)
+		for i := range items {
+			items[i] = fmt.Sprintf(`{"key":"key-%d"}`, i)
+		}
+		return `{"requests":[` + strings.Join(items, ",") + `]}`
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"empty", `{"requests":[]}`, http.StatusBadRequest},
+		{"max size", batch(maxBatchSize), http.StatusOK},
+		{"over max size", batch(maxBatchSize + 1), http.StatusBadRequest},
+		{"too large", `{"requests":[{"key":"` + strings.Repeat("a", maxDecisionBody) + `"}]}`, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		if w := post(mux, "/decisions/batch", tt.body); w.Code != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.status)
+		}
+	}
+}
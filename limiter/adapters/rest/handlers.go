@@ -8,14 +8,15 @@ import (
 	"net/http"
 	"testtask/limiter/adapters/rest/middleware"
 	"testtask/limiter/core"
+	"time"
 )
 
-func MainHandler(rate core.RateLimiter, db core.RateLimiterDB) http.HandlerFunc {
+func MainHandler(rate core.RateLimiter, db core.RateLimiterDB, identifier core.ClientIdentifier, cost core.RequestCost) http.HandlerFunc {
 	handler := func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintf(w, "Allowed =)")
 	}
 
-	return middleware.Rate(handler, rate, db)
+	return middleware.Rate(handler, rate, db, identifier, cost)
 	// Передаем хендлер в лимитер. Если у клиента
 	// остались токены, то пропускаем его дальше
 }
@@ -23,9 +24,9 @@ func MainHandler(rate core.RateLimiter, db core.RateLimiterDB) http.HandlerFunc
 // CRUD Для работы с клиентами
 
 // CreateClientHandler - POST /clients
-// Создает клиента с заданным client_id и capacity
+// Создает клиента с заданным client_id, capacity и, если нужно, refill_rate (токенов в секунду) и algorithm
 // Принимает JSON вида:
-// {"client_id": "string", "capacity": int}
+// {"client_id": "string", "capacity": int, "refill_rate": float, "algorithm": "string"}
 func CreateClientHandler(log *slog.Logger, db core.CrudDB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req core.ClientRequest
@@ -39,11 +40,24 @@ func CreateClientHandler(log *slog.Logger, db core.CrudDB) http.HandlerFunc {
 			http.Error(w, "client_id and capacity are required", http.StatusBadRequest)
 			return
 		}
+		if req.RefillRate < 0 {
+			http.Error(w, "refill_rate must not be negative", http.StatusBadRequest)
+			return
+		}
+		if req.Algorithm != "" && !core.IsAlgorithm(req.Algorithm) {
+			http.Error(w, "unknown algorithm", http.StatusBadRequest)
+			return
+		}
 
+		now := time.Now()
 		client := core.Client{
-			ClientID: req.ClientID,
-			Capacity: req.Capacity,
-			Tokens:   req.Capacity, // Создаем клиента с полным набором токенов по умолчанию
+			ClientID:    req.ClientID,
+			Capacity:    req.Capacity,
+			Tokens:      req.Capacity, // Создаем клиента с полным набором токенов по умолчанию
+			RefillRate:  req.RefillRate,
+			LastRefill:  now,
+			Algorithm:   req.Algorithm,
+			WindowStart: now,
 		}
 
 		if err := db.CreateClient(r.Context(), client); err != nil {
@@ -87,14 +101,21 @@ func GetClientHandler(log *slog.Logger, db core.CrudDB) http.HandlerFunc {
 		clientDb, err := db.GetClient(r.Context(), clientID)
 		if err != nil {
 			log.Error("failed to get client", "error", err)
+
+			if errors.Is(err, core.ErrClientNotFound) {
+				http.Error(w, "client_id not found", http.StatusNotFound)
+				return
+			}
 			http.Error(w, "failed to get client", http.StatusInternalServerError)
 			return
 		}
 
 		client := core.ClientRequest{
-			ClientID: clientDb.ClientID,
-			Capacity: clientDb.Capacity,
-			Tokens:   clientDb.Tokens,
+			ClientID:   clientDb.ClientID,
+			Capacity:   clientDb.Capacity,
+			Tokens:     clientDb.Tokens,
+			RefillRate: clientDb.RefillRate,
+			Algorithm:  clientDb.Algorithm,
 		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(client)
@@ -128,9 +149,9 @@ func DeleteClientHandler(log *slog.Logger, db core.CrudDB) http.HandlerFunc {
 }
 
 // UpdateClientHandler - PUT /client
-// Обновляет capacity заданного клиента
+// Обновляет capacity заданного клиента и, если переданы, refill_rate и algorithm
 // Принимает JSON вида:
-// {"client_id": "string", "capacity": int}
+// {"client_id": "string", "capacity": int, "refill_rate": float, "algorithm": "string"}
 func UpdateClientHandler(log *slog.Logger, db core.CrudDB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req core.ClientRequest
@@ -144,6 +165,10 @@ func UpdateClientHandler(log *slog.Logger, db core.CrudDB) http.HandlerFunc {
 			http.Error(w, "client_id and capacity are required", http.StatusBadRequest)
 			return
 		}
+		if req.Algorithm != "" && !core.IsAlgorithm(req.Algorithm) {
+			http.Error(w, "unknown algorithm", http.StatusBadRequest)
+			return
+		}
 
 		if err := db.UpdateClientCapacity(r.Context(), req.ClientID, req.Capacity); err != nil {
 			log.Error("failed to update client", "error", err)
@@ -151,6 +176,22 @@ func UpdateClientHandler(log *slog.Logger, db core.CrudDB) http.HandlerFunc {
 			return
 		}
 
+		if req.RefillRate > 0 {
+			if err := db.UpdateClientRefillRate(r.Context(), req.ClientID, req.RefillRate); err != nil {
+				log.Error("failed to update client", "error", err)
+				http.Error(w, "failed to update client", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if req.Algorithm != "" {
+			if err := db.UpdateClientAlgorithm(r.Context(), req.ClientID, req.Algorithm); err != nil {
+				log.Error("failed to update client", "error", err)
+				http.Error(w, "failed to update client", http.StatusInternalServerError)
+				return
+			}
+		}
+
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{"status": "client successful updated"})
 	}
@@ -1,26 +1,62 @@
 package middleware
 
 import (
+	"math"
 	"net/http"
-	"strings"
+	"strconv"
 	"testtask/limiter/core"
+	"time"
 )
 
-func Rate(next http.HandlerFunc, rate core.RateLimiter, db core.RateLimiterDB) http.HandlerFunc {
+func Rate(next http.HandlerFunc, rate core.RateLimiter, db core.RateLimiterDB, identifier core.ClientIdentifier, cost core.RequestCost) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		clientID := strings.Split(r.RemoteAddr, ":")
+		clientID, err := identifier.ClientID(r)
+		if err != nil {
+			http.Error(w, "Client identity is required", http.StatusUnauthorized)
+			return
+		}
+
+		// Дорогие запросы (экспорт, массовая запись) списывают больше токенов
+		n, err := cost.Cost(r)
+		if err != nil {
+			http.Error(w, "Invalid request cost", http.StatusBadRequest)
+			return
+		}
 
 		// Узнаем, есть ли у пользователя токены
-		allow, err := rate.AllowClientRequest(r.Context(), clientID[0], db)
+		decision, err := rate.AllowClientRequest(r.Context(), clientID, n, db)
 		if err != nil {
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 
-		if !allow {
+		setRateLimitHeaders(w.Header(), decision)
+
+		if !decision.Allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(max(ceilSeconds(decision.RetryAfter), 1)))
 			http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
 			return
 		}
 		next.ServeHTTP(w, r)
 	}
 }
+
+// Заголовки по черновику IETF (RateLimit-*) и устаревшие X-RateLimit-*.
+// RateLimit-Reset - секунды до пополнения, X-RateLimit-Reset - unix-время пополнения
+func setRateLimitHeaders(h http.Header, decision core.Decision) {
+	limit := strconv.Itoa(decision.Limit)
+	remaining := strconv.Itoa(decision.Remaining)
+
+	h.Set("RateLimit-Limit", limit)
+	h.Set("RateLimit-Remaining", remaining)
+	h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(decision.Reset)))
+
+	h.Set("X-RateLimit-Limit", limit)
+	h.Set("X-RateLimit-Remaining", remaining)
+	h.Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(decision.Reset).Unix(), 10))
+}
+
+// Заголовки принимают целые секунды, округляем вверх, чтобы клиент не пришел раньше времени
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"testtask/limiter/adapters/db"
+	"testtask/limiter/adapters/memory"
+	"testtask/limiter/adapters/redis"
+	"testtask/limiter/config"
+	"testtask/limiter/core"
+)
+
+// Хранилище, с которым работают и лимитер, и CRUD
+type Storage interface {
+	core.RateLimiterDB
+	core.CrudDB
+	Close() error
+}
+
+// Создает хранилище клиентов по типу из конфига, для postgres проводит миграции.
+// Снимки хранилища в памяти сохраняются и неактивные клиенты удаляются в фоне, пока не отменен ctx
+func New(ctx context.Context, log *slog.Logger, dbAddress string, cfg config.StorageConfig) (Storage, error) {
+	switch cfg.Type {
+	case "postgres":
+		storage, err := db.New(log, dbAddress)
+		if err != nil {
+			return nil, err
+		}
+		if err := storage.Migrate(); err != nil {
+			storage.Close()
+			return nil, err
+		}
+		return storage, nil
+	case "memory":
+		storage, err := memory.New(log, cfg.Memory.Shards, cfg.Memory.SnapshotPath)
+		if err != nil {
+			return nil, err
+		}
+		storage.StartSnapshots(ctx, cfg.Memory.SnapshotInterval)
+		storage.StartEviction(ctx, cfg.Memory.IdleTTL)
+		return storage, nil
+	case "redis":
+		r := cfg.Redis
+		return redis.New(log, r.Address, r.Password, r.DB, r.Prefix, r.IdleTTL)
+	default:
+		return nil, fmt.Errorf("unknown storage type: %q", cfg.Type)
+	}
+}
@@ -8,20 +8,138 @@ import (
 )
 
 type HTTPConfig struct {
-	Address string        `yaml:"address" env:"ADDRESS" env-default:"localhost:8080"`
-	Timeout time.Duration `yaml:"timeout" env:"TIMEOUT" env-default:"5s"`
+	Address         string        `yaml:"address" env:"ADDRESS" env-default:"localhost:8080"`
+	Timeout         time.Duration `yaml:"timeout" env:"TIMEOUT" env-default:"5s"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" env-default:"30s"`
 }
 
+// Лимит по умолчанию для новых клиентов. Скорость пополнения refill_rate задается в токенах в секунду,
+// если она не задана, то считается как capacity токенов за update_interval.
+// Algorithm - алгоритм по умолчанию: token_bucket, sliding_window_log, sliding_window_counter или gcra,
+// для скользящих окон capacity - число запросов за window
 type RateLimit struct {
 	Capacity       int           `yaml:"capacity" env:"CAPACITY" env-default:"100"`
+	RefillRate     float64       `yaml:"refill_rate" env:"REFILL_RATE"`
 	UpdateInterval time.Duration `yaml:"update_interval" env:"UPDATE_INTERVAL" env-default:"1s"`
+	Algorithm      string        `yaml:"algorithm" env:"ALGORITHM" env-default:"token_bucket"`
+	Window         time.Duration `yaml:"window" env:"WINDOW" env-default:"1m"`
+}
+
+func (r RateLimit) DefaultRefillRate() float64 {
+	if r.RefillRate > 0 {
+		return r.RefillRate
+	}
+	if r.UpdateInterval <= 0 {
+		return 0
+	}
+	return float64(r.Capacity) / r.UpdateInterval.Seconds()
+}
+
+// Настройки именованной политики для API решений, незаданные поля берутся из лимита по умолчанию
+func (c Config) Policy(name string) (RateLimit, bool) {
+	policy, ok := c.Policies[name]
+	if !ok {
+		return RateLimit{}, false
+	}
+	if policy.Capacity == 0 {
+		policy.Capacity = c.RateLimit.Capacity
+	}
+	if policy.RefillRate == 0 && policy.UpdateInterval == 0 {
+		policy.RefillRate = c.RateLimit.RefillRate
+	}
+	if policy.UpdateInterval == 0 {
+		policy.UpdateInterval = c.RateLimit.UpdateInterval
+	}
+	if policy.Algorithm == "" {
+		policy.Algorithm = c.RateLimit.Algorithm
+	}
+	if policy.Window == 0 {
+		policy.Window = c.RateLimit.Window
+	}
+	return policy, true
+}
+
+// Где хранить клиентов: postgres, memory или redis. Память процесса быстрее, но подходит только для одного экземпляра,
+// состояние переживает перезапуск, если задан snapshot_path, клиенты без запросов дольше idle_ttl удаляются. Redis подходит для нескольких экземпляров лимитера
+type StorageConfig struct {
+	Type   string       `yaml:"type" env:"STORAGE_TYPE" env-default:"postgres"`
+	Memory MemoryConfig `yaml:"memory"`
+	Redis  RedisConfig  `yaml:"redis"`
+	Cache  CacheConfig  `yaml:"cache"`
+}
+
+type MemoryConfig struct {
+	Shards           int           `yaml:"shards" env:"MEMORY_SHARDS" env-default:"64"`
+	SnapshotPath     string        `yaml:"snapshot_path" env:"MEMORY_SNAPSHOT_PATH"`
+	SnapshotInterval time.Duration `yaml:"snapshot_interval" env:"MEMORY_SNAPSHOT_INTERVAL" env-default:"1m"`
+	IdleTTL          time.Duration `yaml:"idle_ttl" env:"MEMORY_IDLE_TTL" env-default:"24h"`
+}
+
+// Локальный кэш token bucket перед хранилищем: off, batch или lease. В режиме batch списания записываются
+// в хранилище раз в sync_interval, в режиме lease токены выкупаются блоками по lease_size,
+// а блоки клиентов без запросов за sync_interval сбрасываются
+type CacheConfig struct {
+	Mode         string        `yaml:"mode" env:"CACHE_MODE" env-default:"off"`
+	SyncInterval time.Duration `yaml:"sync_interval" env:"CACHE_SYNC_INTERVAL" env-default:"100ms"`
+	LeaseSize    int           `yaml:"lease_size" env:"CACHE_LEASE_SIZE" env-default:"10"`
+}
+
+// Ключи клиентов, к которым не было запросов дольше idle_ttl, удаляются, 0 - хранить бессрочно
+type RedisConfig struct {
+	Address  string        `yaml:"address" env:"REDIS_ADDRESS" env-default:"localhost:6379"`
+	Password string        `yaml:"password" env:"REDIS_PASSWORD"`
+	DB       int           `yaml:"db" env:"REDIS_DB"`
+	Prefix   string        `yaml:"prefix" env:"REDIS_PREFIX" env-default:"limiter:"`
+	IdleTTL  time.Duration `yaml:"idle_ttl" env:"REDIS_IDLE_TTL" env-default:"24h"`
+}
+
+// Стоимость запроса в токенах для middleware лимитера. Если задан header, стоимость берется из значения заголовка,
+// иначе из правила, шаблон которого (как в http.ServeMux, например "POST /export/{id}") подходит под запрос,
+// иначе default. Из нескольких подходящих шаблонов выбирается самый специфичный. Заголовок стоит задавать, только если его выставляет доверенный сервис
+type CostConfig struct {
+	Default int        `yaml:"default" env:"COST_DEFAULT" env-default:"1"`
+	Header  string     `yaml:"header" env:"COST_HEADER"`
+	Rules   []CostRule `yaml:"rules"`
+}
+
+type CostRule struct {
+	Pattern string `yaml:"pattern"`
+	Cost    int    `yaml:"cost"`
+}
+
+// Сколько самых активных клиентов выводить в метриках отдельно, 0 выключает метрики по клиентам
+type MetricsConfig struct {
+	TopClients int `yaml:"top_clients" env:"METRICS_TOP_CLIENTS" env-default:"10"`
+}
+
+// Как определять клиента: ip (с учетом доверенных прокси), header (например, API-ключ),
+// bearer (поле sub из JWT) или composite (несколько способов из списка composite)
+type IdentityConfig struct {
+	Type           string   `yaml:"type" env:"IDENTITY_TYPE" env-default:"ip"`
+	TrustedProxies []string `yaml:"trusted_proxies" env:"IDENTITY_TRUSTED_PROXIES"`
+	// Заголовок с цепочкой адресов, который пишет доверенный прокси: X-Forwarded-For или Forwarded
+	ForwardedHeader string   `yaml:"forwarded_header" env:"IDENTITY_FORWARDED_HEADER" env-default:"X-Forwarded-For"`
+	Header          string   `yaml:"header" env:"IDENTITY_HEADER" env-default:"X-API-Key"`
+	JWTSecret       string   `yaml:"jwt_secret" env:"IDENTITY_JWT_SECRET"`
+	Composite       []string `yaml:"composite" env:"IDENTITY_COMPOSITE"`
+}
+
+// Адрес gRPC-сервера, совместимого с внешним rate limit сервисом Envoy, пустой адрес выключает сервер
+type GRPCConfig struct {
+	Address string `yaml:"address" env:"GRPC_ADDRESS"`
 }
 
 type Config struct {
-	LogLevel   string     `yaml:"log_level" env:"LOG_LEVEL" env-default:"DEBUG"`
-	DBAddress  string     `yaml:"db_address" env:"DB_ADDRESS"`
-	RateLimit  RateLimit  `yaml:"ratelimiter"`
-	HTTPConfig HTTPConfig `yaml:"http"`
+	LogLevel   string               `yaml:"log_level" env:"LOG_LEVEL" env-default:"DEBUG"`
+	DBAddress  string               `yaml:"db_address" env:"DB_ADDRESS"`
+	Storage    StorageConfig        `yaml:"storage"`
+	RateLimit  RateLimit            `yaml:"ratelimiter"`
+	Policies   map[string]RateLimit `yaml:"policies"`
+	Identity   IdentityConfig       `yaml:"identity"`
+	Cost       CostConfig           `yaml:"cost"`
+	Metrics    MetricsConfig        `yaml:"metrics"`
+	HTTPConfig HTTPConfig           `yaml:"http"`
+	GRPCConfig GRPCConfig           `yaml:"grpc"`
 }
 
 func MustLoad(configPath string) Config {
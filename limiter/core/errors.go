@@ -4,4 +4,7 @@ import "errors"
 
 var (
 	ErrClientNotFound = errors.New("client was not found")
+	ErrNoClientID     = errors.New("client identity was not found in request")
+	ErrUnknownPolicy  = errors.New("unknown rate limit policy")
+	ErrInvalidCost    = errors.New("request cost must be a positive integer")
 )
@@ -1,13 +1,206 @@
 package core
 
+import (
+	"math"
+	"time"
+)
+
+// Состояние token bucket клиента. Токены пополняются непрерывно со скоростью RefillRate токенов в секунду,
+// но считаются лениво: в бд хранится число токенов на момент LastRefill
+// Алгоритм лимитера задается глобально в конфиге или отдельно для клиента
 type Client struct {
-	ClientID string `db:"client_id"`
-	Capacity int    `db:"capacity"`
-	Tokens   int    `db:"tokens"`
+	ClientID   string    `db:"client_id"`
+	Capacity   int       `db:"capacity"`
+	Tokens     int       `db:"tokens"`
+	RefillRate float64   `db:"refill_rate"` // 0 - скорость по умолчанию из конфига
+	LastRefill time.Time `db:"last_refill"`
+	Algorithm  string    `db:"algorithm"` // пустая строка - алгоритм по умолчанию из конфига
+	// Состояние sliding window counter: начало текущего окна и число запросов в текущем и предыдущем окнах
+	WindowStart time.Time `db:"window_start"`
+	WindowCount int       `db:"window_count"`
+	PrevCount   int       `db:"prev_count"`
+	// Состояние GCRA: теоретическое время прихода следующего запроса
+	TAT time.Time `db:"tat"`
+}
+
+const (
+	AlgorithmTokenBucket   = "token_bucket"
+	AlgorithmSlidingLog    = "sliding_window_log"
+	AlgorithmSlidingWindow = "sliding_window_counter"
+	AlgorithmGCRA          = "gcra"
+)
+
+func IsAlgorithm(name string) bool {
+	switch name {
+	case AlgorithmTokenBucket, AlgorithmSlidingLog, AlgorithmSlidingWindow, AlgorithmGCRA:
+		return true
+	}
+	return false
+}
+
+// Запросы клиента в скользящем окне sliding window log
+type WindowLog struct {
+	Count  int
+	Oldest time.Time
+	Newest time.Time
+}
+
+// Скорость пополнения клиента, defaultRate используется для клиентов без своей скорости
+func (c Client) Rate(defaultRate float64) float64 {
+	if c.RefillRate > 0 {
+		return c.RefillRate
+	}
+	return defaultRate
+}
+
+// Добавляет токены, накопившиеся с LastRefill. Время сдвигается только на целое число токенов,
+// чтобы дробная часть не терялась между запросами. У полного bucket время сбрасывается на текущее
+func (c *Client) Refill(now time.Time, defaultRate float64) {
+	if c.Tokens >= c.Capacity {
+		c.Tokens = c.Capacity
+		c.LastRefill = now
+		return
+	}
+
+	rate := c.Rate(defaultRate)
+	if rate <= 0 {
+		return
+	}
+
+	added := int(now.Sub(c.LastRefill).Seconds() * rate)
+	if added <= 0 {
+		return
+	}
+
+	c.Tokens += added
+	if c.Tokens >= c.Capacity {
+		c.Tokens = c.Capacity
+		c.LastRefill = now
+		return
+	}
+	c.LastRefill = c.LastRefill.Add(Seconds(float64(added) / rate))
+}
+
+// Сдвигает окна sliding window counter на момент now. Через одно окно текущий счетчик становится предыдущим,
+// через два и больше оба обнуляются, а новое окно начинается с now
+func (c *Client) ShiftWindow(now time.Time, window time.Duration) {
+	if window <= 0 || now.Before(c.WindowStart) {
+		return
+	}
+
+	switch elapsed := now.Sub(c.WindowStart); {
+	case elapsed < window:
+		return
+	case elapsed < 2*window:
+		c.PrevCount = c.WindowCount
+		c.WindowStart = c.WindowStart.Add(window)
+	default:
+		c.PrevCount = 0
+		c.WindowStart = now
+	}
+	c.WindowCount = 0
+}
+
+// Оценка числа запросов в скользящем окне: предыдущее окно учитывается с весом оставшейся от него доли
+func (c Client) WindowEstimate(now time.Time, window time.Duration) float64 {
+	if window <= 0 {
+		return float64(c.WindowCount)
+	}
+	elapsed := min(max(now.Sub(c.WindowStart), 0), window)
+	return float64(c.PrevCount)*(1-float64(elapsed)/float64(window)) + float64(c.WindowCount)
+}
+
+// Через сколько от начала текущего окна оценка с n новыми запросами перестанет превышать capacity.
+// Округляется вверх до микросекунды, Postgres и Redis считают порог так же, поэтому запрос ровно через
+// Retry-After проходит во всех хранилищах. false, если n запросов не помещаются до конца окна
+func (c Client) WindowThreshold(n int, window time.Duration) (time.Duration, bool) {
+	free := c.Capacity - c.WindowCount - n
+	if free < 0 {
+		return 0, false
+	}
+	if c.PrevCount <= free || window <= 0 {
+		return 0, true
+	}
+	micro := math.Ceil(float64(window/time.Microsecond) * float64(c.PrevCount-free) / float64(c.PrevCount))
+	return time.Duration(micro) * time.Microsecond, true
+}
+
+// Пропускает ли sliding window counter n запросов в момент now, окна уже сдвинуты ShiftWindow.
+// То же, что WindowEstimate + n <= capacity, но без ошибок округления на границе
+func (c Client) WindowAllows(n int, now time.Time, window time.Duration) bool {
+	threshold, ok := c.WindowThreshold(n, window)
+	return ok && now.Sub(c.WindowStart) >= threshold
+}
+
+// Учитывает n запросов по GCRA: каждый запрос сдвигает TAT на интервал 1/rate, запрос пропускается,
+// если TAT уходит вперед от now не больше чем на capacity интервалов. Отклоненный запрос TAT не меняет.
+// Клиента без скорости пополнения GCRA не пропускает
+func (c *Client) ConsumeGCRA(n int, now time.Time, defaultRate float64) bool {
+	rate := c.Rate(defaultRate)
+	if rate <= 0 {
+		return false
+	}
+
+	interval := EmissionInterval(rate)
+	tat := c.TAT
+	if tat.Before(now) {
+		tat = now
+	}
+
+	next := tat.Add(time.Duration(n) * interval)
+	if next.Sub(now) > time.Duration(c.Capacity)*interval {
+		return false
+	}
+	c.TAT = next
+	return true
+}
+
+// Переводит дробное число секунд в time.Duration с округлением вверх
+func Seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
+
+// Интервал GCRA между запросами при скорости rate, округленный вверх до микросекунды.
+// Postgres и Redis хранят TAT в микросекундах и считают интервал так же, поэтому Retry-After точен для всех хранилищ
+func EmissionInterval(rate float64) time.Duration {
+	return time.Duration(math.Ceil(float64(time.Second/time.Microsecond)/rate)) * time.Microsecond
 }
 
 type ClientRequest struct {
-	ClientID string `json:"client_id"`
-	Capacity int    `json:"capacity"`
-	Tokens   int    `json:"tokens"`
+	ClientID   string  `json:"client_id"`
+	Capacity   int     `json:"capacity"`
+	Tokens     int     `json:"tokens"`
+	RefillRate float64 `json:"refill_rate"`
+	Algorithm  string  `json:"algorithm"`
+}
+
+// Решение лимитера по запросу клиента
+type Decision struct {
+	Allowed bool
+	// Лимит клиента и сколько токенов у него осталось после запроса
+	Limit     int
+	Remaining int
+	// Через сколько токены будут пополнены
+	Reset time.Duration
+	// Через сколько имеет смысл повторить отклоненный запрос, 0 для разрешенных запросов
+	RetryAfter time.Duration
+}
+
+// Запрос к API решений: списать cost токенов с ключа key в политике policy
+type DecisionRequest struct {
+	Key    string `json:"key"`
+	Cost   int    `json:"cost"`
+	Policy string `json:"policy"`
+}
+
+// Ответ API решений, reset и retry_after в секундах
+type DecisionResponse struct {
+	Key        string  `json:"key"`
+	Policy     string  `json:"policy,omitempty"`
+	Allowed    bool    `json:"allowed"`
+	Limit      int     `json:"limit"`
+	Remaining  int     `json:"remaining"`
+	Reset      float64 `json:"reset"`
+	RetryAfter float64 `json:"retry_after"`
+	Error      string  `json:"error,omitempty"`
 }
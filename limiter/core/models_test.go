@@ -0,0 +1,164 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEmissionInterval(t *testing.T) {
+	tests := []struct {
+		rate float64
+		want time.Duration
+	}{
+		{1, time.Second},
+		{10, 100 * time.Millisecond},
+		{3, 333334 * time.Microsecond},
+		{0.1, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := EmissionInterval(tt.rate); got != tt.want {
+			t.Errorf("rate %v: interval %v, want %v", tt.rate, got, tt.want)
+		}
+	}
+}
+
+// Последовательность запросов: после пачки до capacity запросы проходят по одному в интервал,
+// отклоненный запрос TAT не меняет
+func TestConsumeGCRA(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) time.Time { return start.Add(d) }
+
+	type step struct {
+		at      time.Time
+		n       int
+		allowed bool
+		tat     time.Time
+	}
+	tests := []struct {
+		name     string
+		capacity int
+		rate     float64
+		steps    []step
+	}{
+		{"burst up to capacity", 3, 1, []step{
+			{at(0), 1, true, at(time.Second)},
+			{at(0), 1, true, at(2 * time.Second)},
+			{at(0), 1, true, at(3 * time.Second)},
+			{at(0), 1, false, at(3 * time.Second)},
+			{at(time.Second - time.Nanosecond), 1, false, at(3 * time.Second)},
+			{at(time.Second), 1, true, at(4 * time.Second)},
+		}},
+		{"cost above one", 4, 2, []step{
+			{at(0), 3, true, at(1500 * time.Millisecond)},
+			{at(0), 2, false, at(1500 * time.Millisecond)},
+			{at(0), 1, true, at(2 * time.Second)},
+			{at(time.Second - time.Nanosecond), 2, false, at(2 * time.Second)},
+			{at(time.Second), 2, true, at(3 * time.Second)},
+		}},
+		{"idle resets tat", 2, 1, []step{
+			{at(0), 2, true, at(2 * time.Second)},
+			{at(10 * time.Second), 2, true, at(12 * time.Second)},
+		}},
+		{"rounded interval", 1, 3, []step{
+			{at(0), 1, true, at(333334 * time.Microsecond)},
+			{at(333333 * time.Microsecond), 1, false, at(333334 * time.Microsecond)},
+			{at(333334 * time.Microsecond), 1, true, at(666668 * time.Microsecond)},
+		}},
+		{"cost above capacity", 2, 1, []step{
+			{at(0), 3, false, at(0)},
+		}},
+	}
+	for _, tt := range tests {
+		c := Client{Capacity: tt.capacity, RefillRate: tt.rate, TAT: start}
+		for i, s := range tt.steps {
+			if got := c.ConsumeGCRA(s.n, s.at, 0); got != s.allowed || !c.TAT.Equal(s.tat) {
+				t.Errorf("%s, step %d: allowed %v, tat %v, want %v and %v", tt.name, i, got, c.TAT.Sub(start), s.allowed, s.tat.Sub(start))
+			}
+		}
+	}
+
+	// Без скорости у клиента и по умолчанию запросы не проходят
+	c := Client{Capacity: 2, TAT: start}
+	if c.ConsumeGCRA(1, start, 0) {
+		t.Error("allowed request without rate")
+	}
+	if !c.ConsumeGCRA(1, start, 1) {
+		t.Error("denied request with default rate")
+	}
+}
+
+func TestShiftWindow(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	window := 10 * time.Second
+
+	tests := []struct {
+		name      string
+		now       time.Time
+		wantStart time.Time
+		wantPrev  int
+		wantCount int
+	}{
+		{"same window", start.Add(9 * time.Second), start, 2, 5},
+		{"before start", start.Add(-time.Second), start, 2, 5},
+		{"next window", start.Add(window), start.Add(window), 5, 0},
+		{"end of next window", start.Add(2*window - time.Nanosecond), start.Add(window), 5, 0},
+		// Через два окна и больше оба счетчика обнуляются, новое окно начинается с now
+		{"two windows", start.Add(2 * window), start.Add(2 * window), 0, 0},
+		{"long idle", start.Add(time.Hour + time.Second), start.Add(time.Hour + time.Second), 0, 0},
+	}
+	for _, tt := range tests {
+		c := Client{WindowStart: start, PrevCount: 2, WindowCount: 5}
+		c.ShiftWindow(tt.now, window)
+		if !c.WindowStart.Equal(tt.wantStart) || c.PrevCount != tt.wantPrev || c.WindowCount != tt.wantCount {
+			t.Errorf("%s: start %v, prev %d, count %d, want %v, %d and %d",
+				tt.name, c.WindowStart.Sub(start), c.PrevCount, c.WindowCount, tt.wantStart.Sub(start), tt.wantPrev, tt.wantCount)
+		}
+	}
+}
+
+func TestWindowEstimate(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	window := 10 * time.Second
+	c := Client{WindowStart: start, PrevCount: 4, WindowCount: 3}
+
+	tests := []struct {
+		now  time.Time
+		want float64
+	}{
+		{start, 7},
+		{start.Add(-time.Second), 7},
+		{start.Add(5 * time.Second), 5},
+		{start.Add(window), 3},
+		{start.Add(2 * window), 3},
+	}
+	for _, tt := range tests {
+		if got := c.WindowEstimate(tt.now, window); got != tt.want {
+			t.Errorf("at %v: estimate %v, want %v", tt.now.Sub(start), got, tt.want)
+		}
+	}
+}
+
+func TestWindowThreshold(t *testing.T) {
+	window := 10 * time.Second
+
+	tests := []struct {
+		name     string
+		client   Client
+		n        int
+		want     time.Duration
+		wantFits bool
+	}{
+		{"previous window fits", Client{Capacity: 5, PrevCount: 2, WindowCount: 1}, 2, 0, true},
+		{"wait for previous weight", Client{Capacity: 5, PrevCount: 4, WindowCount: 1}, 2, 5 * time.Second, true},
+		// 10s * 2/3 округляется вверх до микросекунды
+		{"rounded up", Client{Capacity: 5, PrevCount: 3, WindowCount: 3}, 1, 6666667 * time.Microsecond, true},
+		{"current window full", Client{Capacity: 5, PrevCount: 0, WindowCount: 5}, 1, 0, false},
+		{"cost above capacity", Client{Capacity: 5}, 6, 0, false},
+	}
+	for _, tt := range tests {
+		got, fits := tt.client.WindowThreshold(tt.n, window)
+		if got != tt.want || fits != tt.wantFits {
+			t.Errorf("%s: threshold %v, fits %v, want %v and %v", tt.name, got, fits, tt.want, tt.wantFits)
+		}
+	}
+}
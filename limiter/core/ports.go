@@ -2,6 +2,7 @@ package core
 
 import (
 	"context"
+	"net/http"
 	"time"
 )
 
@@ -11,20 +12,41 @@ import (
 type RateLimiterDB interface {
 	GetClient(context.Context, string) (Client, error)
 	CreateClient(context.Context, Client) error
-	UpdateClientToken(context.Context, string, int) error
+	// Атомарно пополняет bucket клиента на момент now и списывает n токенов, если их хватает.
+	// Возвращает состояние клиента после операции и признак того, что токены списаны.
+	// Для клиентов без своей скорости пополнения используется defaultRate
+	ConsumeTokens(ctx context.Context, clientID string, n int, now time.Time, defaultRate float64) (Client, bool, error)
+	// Атомарно удаляет из лога клиента запросы старше window и записывает n новых, если они помещаются в capacity
+	ConsumeWindowLog(ctx context.Context, clientID string, n int, now time.Time, window time.Duration) (Client, WindowLog, bool, error)
+	// Атомарно сдвигает окна счетчика клиента и учитывает n запросов, если оценка с ними не превышает capacity
+	ConsumeWindowCounter(ctx context.Context, clientID string, n int, now time.Time, window time.Duration) (Client, bool, error)
+	// Атомарно учитывает n запросов клиента по GCRA, арифметика как в Client.ConsumeGCRA
+	ConsumeGCRA(ctx context.Context, clientID string, n int, now time.Time, defaultRate float64) (Client, bool, error)
 	UpdateClientCapacity(context.Context, string, int) error
-	UpdateAllTokens(context.Context) error
 }
 
 type CrudDB interface {
 	GetClient(context.Context, string) (Client, error)
 	GetAllClients(context.Context) ([]Client, error)
+	CountClients(context.Context) (int, error)
 	CreateClient(context.Context, Client) error
 	RemoveClient(context.Context, string) error
 	UpdateClientCapacity(context.Context, string, int) error
+	UpdateClientRefillRate(context.Context, string, float64) error
+	UpdateClientAlgorithm(context.Context, string, string) error
 }
 
+// Решает, можно ли пропустить запрос клиента стоимостью cost токенов (для окон - cost запросов)
 type RateLimiter interface {
-	AllowClientRequest(context.Context, string, RateLimiterDB) (bool, error)
-	UpdateTokensJob(context.Context, time.Duration, RateLimiterDB)
+	AllowClientRequest(ctx context.Context, clientID string, cost int, db RateLimiterDB) (Decision, error)
+}
+
+// Определяет, какому клиенту принадлежит запрос. Реализация (ip, заголовок, токен) задается в конфиге
+type ClientIdentifier interface {
+	ClientID(*http.Request) (string, error)
+}
+
+// Сколько токенов стоит запрос
+type RequestCost interface {
+	Cost(*http.Request) (int, error)
 }
@@ -2,14 +2,25 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
-	"testtask/limiter/adapters/db"
+	"os/signal"
+	"syscall"
+	"testtask/limiter/adapters/cache"
+	"testtask/limiter/adapters/cost"
+	"testtask/limiter/adapters/grpc"
+	"testtask/limiter/adapters/identity"
+	"testtask/limiter/adapters/metrics"
 	"testtask/limiter/adapters/ratelimiter"
 	"testtask/limiter/adapters/rest"
+	"testtask/limiter/adapters/storage"
 	"testtask/limiter/config"
+
+	grpclib "google.golang.org/grpc"
 )
 
 func main() {
@@ -24,25 +35,63 @@ func main() {
 	log := mustMakeLogger(cfg.LogLevel)
 	log.Info("starting server")
 
-	// Инициализируем бд, проводим миграции
-	storage, err := db.New(log, cfg.DBAddress)
+	// Контекст отменяется по SIGINT/SIGTERM, после этого останавливаем сервер и закрываем хранилище
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Инициализируем хранилище клиентов (postgres, memory или redis), для postgres проводим миграции
+	storage, err := storage.New(ctx, log, cfg.DBAddress, cfg.Storage)
 	if err != nil {
-		log.Error("failed to connect to db", "error", err)
+		log.Error("failed to init storage", "error", err)
 		os.Exit(1)
 	}
-	if err := storage.Migrate(); err != nil {
-		log.Error("failed to migrate db", "error", err)
+	defer storage.Close()
+
+	// Инициализируем лимитер, лимитер и бд оборачиваем метриками
+	m := metrics.New(log, cfg.Metrics.TopClients)
+	m.RegisterClients(storage)
+	limiterDB := m.InstrumentDB(storage)
+	// Локальный кэш токенов снижает число запросов к хранилищу ценой точности лимита
+	var tokenCache *cache.Cache
+	if cfg.Storage.Cache.Mode != "off" {
+		c := cfg.Storage.Cache
+		tokenCache, err = cache.New(log, limiterDB, c.Mode, c.SyncInterval, c.LeaseSize)
+		if err != nil {
+			log.Error("failed to configure cache", "error", err)
+			os.Exit(1)
+		}
+		tokenCache.Start(ctx)
+		limiterDB = tokenCache
+	}
+	// Алгоритм выбирается для каждого клиента отдельно, по умолчанию - из конфига.
+	// Для API решений дополнительно создаются лимитеры именованных политик
+	policies, err := ratelimiter.NewPolicies(log, cfg, m.InstrumentLimiter)
+	if err != nil {
+		log.Error("failed to configure rate limiter", "error", err)
+		os.Exit(1)
+	}
+	rl := policies.Default()
+
+	// Способ определения клиента задается в конфиге
+	identifier, err := identity.New(cfg.Identity)
+	if err != nil {
+		log.Error("failed to configure client identity", "error", err)
 		os.Exit(1)
 	}
 
-	// Инициализируем лимитер
-	ctx, cancel := context.WithCancel(context.Background())
-	rl := ratelimiter.New(ctx, log, cfg, storage)
-	defer cancel()
+	// Стоимость запроса в токенах: по заголовку, шаблону метода и пути или по умолчанию
+	requestCost, err := cost.New(cfg.Cost)
+	if err != nil {
+		log.Error("failed to configure request cost", "error", err)
+		os.Exit(1)
+	}
 
 	// Добавляем обработчики для эндпоинтов
 	mux := http.NewServeMux()
-	mux.HandleFunc("GET /test", rest.MainHandler(rl, storage))
+	mux.HandleFunc("GET /test", rest.MainHandler(rl, limiterDB, identifier, requestCost))
+	mux.Handle("GET /metrics", m.Handler())
+	mux.HandleFunc("POST /decisions", rest.DecisionHandler(log, policies, limiterDB))
+	mux.HandleFunc("POST /decisions/batch", rest.BatchDecisionHandler(log, policies, limiterDB))
 
 	mux.HandleFunc("POST /clients", rest.CreateClientHandler(log, storage))
 	mux.HandleFunc("GET /clients", rest.GetClientsHandler(log, storage))
@@ -56,10 +105,50 @@ func main() {
 		ReadTimeout: cfg.HTTPConfig.Timeout,
 	}
 
-	log.Info("starting server", "address", cfg.HTTPConfig.Address)
-	if err := server.ListenAndServe(); err != nil {
-		log.Error("server error", "error", err)
+	go func() {
+		log.Info("starting server", "address", cfg.HTTPConfig.Address)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error("server error", "error", err)
+			stop()
+		}
+	}()
+
+	// gRPC-сервер для Envoy (envoy.service.ratelimit.v3.RateLimitService), если задан адрес
+	var grpcServer *grpclib.Server
+	if cfg.GRPCConfig.Address != "" {
+		lis, err := net.Listen("tcp", cfg.GRPCConfig.Address)
+		if err != nil {
+			log.Error("failed to listen grpc", "error", err)
+			os.Exit(1)
+		}
+		grpcServer = grpc.NewServer(log, policies, limiterDB)
+		go func() {
+			log.Info("starting grpc server", "address", cfg.GRPCConfig.Address)
+			if err := grpcServer.Serve(lis); err != nil {
+				log.Error("grpc server error", "error", err)
+				stop()
+			}
+		}()
+	}
+
+	<-ctx.Done()
+	log.Info("shutting down server", "timeout", cfg.HTTPConfig.ShutdownTimeout)
+
+	// Перестаем принимать новые соединения и ждем завершения текущих запросов, но не дольше таймаута.
+	// Хранилище закрывается последним через defer
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), cfg.HTTPConfig.ShutdownTimeout)
+	defer shutdownCancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Error("failed to shutdown server", "error", err)
+	}
+	if grpcServer != nil {
+		grpcServer.GracefulStop()
+	}
+	// Записываем накопленные в кэше списания до закрытия хранилища
+	if tokenCache != nil {
+		tokenCache.Flush(shutdownCtx)
 	}
+	log.Info("server stopped")
 }
 
 func mustMakeLogger(logLevel string) *slog.Logger {
@@ -2,12 +2,14 @@ package config
 
 import (
 	"log"
+	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
 type Config struct {
-	URLs string `yaml:"urls" env:"URLS" env-default:":8081,:8082,:8083"`
+	URLs            string        `yaml:"urls" env:"URLS" env-default:":8081,:8082,:8083"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" env-default:"30s"`
 }
 
 func MustLoad(configPath string) Config {
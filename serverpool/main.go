@@ -1,11 +1,17 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
 	"testtask/serverpool/config"
 )
 
@@ -19,6 +25,11 @@ func main() {
 	cfg := config.MustLoad(configPath)
 	addrs := strings.Split(cfg.URLs, ",")
 
+	// Контекст отменяется по SIGINT/SIGTERM, после этого останавливаем все серверы пула
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var servers []*http.Server
 	for _, addr := range addrs {
 		mux := http.NewServeMux()
 
@@ -30,14 +41,33 @@ func main() {
 			Addr:    addr,
 			Handler: mux,
 		}
+		servers = append(servers, server)
 
 		go func() {
 			log.Printf("Starting server on %s", addr)
-			if err := server.ListenAndServe(); err != nil {
+			if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 				log.Fatalf("Failed to start server on %s: %v", addr, err)
 			}
 		}()
 	}
 
-	select {}
+	<-ctx.Done()
+	log.Printf("Shutting down servers, timeout %s", cfg.ShutdownTimeout)
+
+	// Перестаем принимать новые соединения и ждем завершения текущих запросов, но не дольше таймаута
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, server := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := server.Shutdown(shutdownCtx); err != nil {
+				log.Printf("Failed to shutdown server on %s: %v", server.Addr, err)
+			}
+		}()
+	}
+	wg.Wait()
+	log.Printf("Servers stopped")
 }